@@ -14,6 +14,13 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/niharrathod/ruleengine/app/config"
 	"github.com/niharrathod/ruleengine/app/controlplane"
+	"github.com/niharrathod/ruleengine/app/controlplane/gitops"
+	"github.com/niharrathod/ruleengine/app/controlplane/scheduler"
+	cpservice "github.com/niharrathod/ruleengine/app/controlplane/service"
+	"github.com/niharrathod/ruleengine/app/dataplane"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	dpservice "github.com/niharrathod/ruleengine/app/dataplane/service"
+	"github.com/niharrathod/ruleengine/app/dataplane/worker"
 	"github.com/niharrathod/ruleengine/app/ext/datastore"
 	"github.com/niharrathod/ruleengine/app/handler"
 	"github.com/niharrathod/ruleengine/app/log"
@@ -23,7 +30,13 @@ import (
 )
 
 type appServer struct {
-	httpserver *http.Server
+	httpserver  *http.Server
+	store       datastore.Store
+	ruleEngines *registry.Registry
+	worker      *worker.Worker
+	scheduler   *scheduler.Scheduler
+	gitOps      *gitops.Reconciler
+	dataPlane   *dpservice.Service
 }
 
 func New() *appServer {
@@ -37,7 +50,25 @@ func New() *appServer {
 func (app *appServer) init() {
 	config.Initialize()
 	log.Initialize()
-	datastore.Initialize()
+
+	store, err := datastore.New()
+	if err != nil {
+		log.Logger.Error("Datastore initialization failed", zap.String("error", err.Error()))
+		os.Exit(1)
+	}
+	app.store = store
+
+	// prepare RuleEngine instances of enabled tags for data plane operation and keep them in sync
+	app.ruleEngines = registry.New(app.store)
+	app.worker = worker.New(app.store, app.ruleEngines)
+	if err := app.worker.Start(); err != nil {
+		log.Logger.Error("Worker start failed", zap.String("error", err.Error()))
+		os.Exit(1)
+	}
+
+	// apply scheduled tag activations and expiries
+	app.scheduler = scheduler.New(app.store, app.ruleEngines)
+	app.scheduler.Start()
 }
 
 func (app *appServer) Run() {
@@ -47,21 +78,64 @@ func (app *appServer) Run() {
 	}
 
 	router := gin.New()
+	// request context values(i.e. audit origin) are visible through gin context
+	router.ContextWithFallback = true
 	router.Use(ginzap.Ginzap(log.Logger, time.RFC3339, true))
 	router.Use(ginzap.RecoveryWithZap(log.Logger, true))
+	router.Use(handler.Origin())
 
 	rest := router.Group("health")
 	rest.GET("/check/", handler.HealthCheck())
 
+	// shadow metrics only, rest of expvar(i.e. cmdline, memstats) is not exposed
+	router.GET("/debug/vars", dataplane.ShadowMetrics())
+
+	controlPlane := cpservice.New(app.store, app.ruleEngines)
+	dataPlane := dpservice.New(app.store, app.ruleEngines)
+	app.dataPlane = dataPlane
+
+	// reconcile RuleEngines declared in gitops directory before serving, and on every file change
+	if config.GitOps != nil {
+		app.gitOps = gitops.New(controlPlane)
+		app.gitOps.Start()
+	}
+
 	reApi := router.Group("/api")
-	reApi.GET("/ruleengines/:ruleengine/", controlplane.GetRuleEngine())
-	reApi.POST("/ruleengines/:ruleengine/tags/:tag", controlplane.CreateRuleEngine())
-	reApi.DELETE("/ruleengines/:ruleengine", controlplane.DeleteRuleEngine())
-	reApi.DELETE("/ruleengines/:ruleengine/tags/:tag", controlplane.DeleteRuleEngineConfig())
-	reApi.PATCH("/ruleengines/:ruleengine/tags/:tag/setdefault", controlplane.SetDefaultTag())
-	reApi.PATCH("/ruleengines/:ruleengine/removedefault", controlplane.RemoveDefaultTag())
-	reApi.PATCH("/ruleengines/:ruleengine/tags/:tag/enable", controlplane.EnableRuleEngine())
-	reApi.PATCH("/ruleengines/:ruleengine/tags/:tag/disable", controlplane.DisableRuleEngine())
+	reApi.GET("/ruleengines", controlplane.ListRuleEngines(controlPlane))
+	reApi.GET("/export", controlplane.Export(controlPlane))
+	reApi.POST("/import", controlplane.Import(controlPlane))
+	if app.gitOps != nil {
+		reApi.GET("/gitops", controlplane.GitOpsStatus(app.gitOps))
+	}
+	reApi.GET("/ruleengines/:ruleengine/", controlplane.GetRuleEngine(controlPlane))
+	reApi.GET("/ruleengines/:ruleengine/tags/:tag", controlplane.GetTag(controlPlane))
+	reApi.POST("/ruleengines/:ruleengine/tags/:tag", controlplane.CreateRuleEngine(controlPlane))
+	reApi.PUT("/ruleengines/:ruleengine/tags/:tag", controlplane.UpdateTagConfig(controlPlane))
+	reApi.POST("/ruleengines/:ruleengine/tags/:tag/clone", controlplane.CloneTag(controlPlane))
+	reApi.POST("/ruleengines/:ruleengine/apply", controlplane.Apply(controlPlane))
+	reApi.PATCH("/ruleengines/:ruleengine/rename", controlplane.RenameRuleEngine(controlPlane))
+	reApi.PATCH("/ruleengines/:ruleengine/tags/:tag/rename", controlplane.RenameTag(controlPlane))
+	reApi.DELETE("/ruleengines/:ruleengine", controlplane.DeleteRuleEngine(controlPlane))
+	reApi.DELETE("/ruleengines/:ruleengine/tags/:tag", controlplane.DeleteRuleEngineConfig(controlPlane))
+	reApi.PATCH("/ruleengines/:ruleengine/tags/:tag/setdefault", controlplane.SetDefaultTag(controlPlane))
+	reApi.PATCH("/ruleengines/:ruleengine/removedefault", controlplane.RemoveDefaultTag(controlPlane))
+	reApi.POST("/ruleengines/:ruleengine/rollback", controlplane.RollbackDefaultTag(controlPlane))
+	reApi.PATCH("/ruleengines/:ruleengine/tags/:tag/enable", controlplane.EnableRuleEngine(controlPlane))
+	reApi.PATCH("/ruleengines/:ruleengine/tags/:tag/disable", controlplane.DisableRuleEngine(controlPlane))
+	reApi.PUT("/ruleengines/:ruleengine/tags/:tag/schedule", controlplane.SetTagSchedule(controlPlane))
+	reApi.DELETE("/ruleengines/:ruleengine/tags/:tag/schedule", controlplane.RemoveTagSchedule(controlPlane))
+	reApi.PUT("/ruleengines/:ruleengine/aliases/:alias", controlplane.SetAlias(controlPlane))
+	reApi.GET("/ruleengines/:ruleengine/aliases/:alias", controlplane.GetAlias(controlPlane))
+	reApi.DELETE("/ruleengines/:ruleengine/aliases/:alias", controlplane.DeleteAlias(controlPlane))
+	reApi.PUT("/ruleengines/:ruleengine/trafficsplit", controlplane.SetTrafficSplit(controlPlane))
+	reApi.DELETE("/ruleengines/:ruleengine/trafficsplit", controlplane.RemoveTrafficSplit(controlPlane))
+	reApi.PUT("/ruleengines/:ruleengine/shadow", controlplane.SetShadowTag(controlPlane))
+	reApi.DELETE("/ruleengines/:ruleengine/shadow", controlplane.RemoveShadowTag(controlPlane))
+	reApi.GET("/ruleengines/:ruleengine/diff", controlplane.GetDiff(controlPlane))
+	reApi.GET("/ruleengines/:ruleengine/history", controlplane.GetHistory(controlPlane))
+	reApi.GET("/ruleengines/:ruleengine/shadow/disagreements", controlplane.ListShadowDisagreements(controlPlane))
+	reApi.POST("/ruleengines/:ruleengine/evaluate", dataplane.Evaluate(dataPlane))
+	reApi.POST("/ruleengines/:ruleengine/tags/:tag/evaluate", dataplane.Evaluate(dataPlane))
 	app.httpserver = &http.Server{
 		Addr:    config.Server.Http.BindIp + ":" + strconv.Itoa(config.Server.Http.BindPort),
 		Handler: router,
@@ -91,7 +165,10 @@ func (app *appServer) prepAndWaitForShutDown() {
 To tear down the app. Order of tear down activities is important
 
  1. http listener - to stop incoming traffic
- 2. close datastore connection
+ 2. in-flight shadow evaluations - to let them record disagreements
+ 3. scheduler and gitops reconciler - to stop changing RuleEngines
+ 4. background worker - to stop observing datastore changes
+ 5. close datastore connection
     # Add more activities here
     log sync should be last activity
 */
@@ -106,8 +183,24 @@ func (app *appServer) shutdown() {
 		log.Logger.Error("Server Shutdown failed:", zap.String("error", err.Error()))
 	}
 
+	// wait for in-flight shadow evaluations
+	app.dataPlane.Stop(shutdownContext)
+
+	// stop scheduler
+	app.scheduler.Stop(shutdownContext)
+
+	// stop gitops reconciler
+	if app.gitOps != nil {
+		app.gitOps.Stop(shutdownContext)
+	}
+
+	// stop background worker
+	app.worker.Stop(shutdownContext)
+
 	// close datastore connection
-	datastore.Close(shutdownContext)
+	if err := app.store.Close(shutdownContext); err != nil {
+		log.Logger.Error("Datastore close failed:", zap.String("error", err.Error()))
+	}
 
 	// sync logs
 	err := log.Logger.Sync()
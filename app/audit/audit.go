@@ -0,0 +1,28 @@
+package audit
+
+import (
+	"context"
+)
+
+// actor of changes made without identified caller
+const UnknownActor = "unknown"
+
+// Origin identifies who made control plane change and request which made it
+type Origin struct {
+	Actor     string
+	RequestID string
+}
+
+type originKey struct{}
+
+func NewContext(ctx context.Context, origin *Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// FromContext returns origin of ctx, unknown actor in case ctx carries no origin
+func FromContext(ctx context.Context) *Origin {
+	if origin, ok := ctx.Value(originKey{}).(*Origin); ok {
+		return origin
+	}
+	return &Origin{Actor: UnknownActor}
+}
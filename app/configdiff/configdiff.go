@@ -0,0 +1,188 @@
+package configdiff
+
+import (
+	"bytes"
+	"sort"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+)
+
+// Of computes structured difference of RuleEngineConfigs, from as base. Conditions, conditionTypes and result
+// values are compared canonically(see digest.Canonical), i.e. only semantic changes are reported.
+func Of(from *ruleenginecore.RuleEngineConfig, to *ruleenginecore.RuleEngineConfig) (*entities.ConfigDiff, error) {
+	result := &entities.ConfigDiff{
+		Fields: diffFields(from.Fields, to.Fields),
+	}
+
+	var err error
+	if result.ConditionTypes, err = diffConditionTypes(from.ConditionTypes, to.ConditionTypes); err != nil {
+		return nil, err
+	}
+	if result.Rules, err = diffRules(from.Rules, to.Rules); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func diffFields(from ruleenginecore.Fields, to ruleenginecore.Fields) *entities.FieldsDiff {
+	result := &entities.FieldsDiff{
+		Added:       map[string]string{},
+		Removed:     map[string]string{},
+		TypeChanged: map[string]*entities.FieldTypeChange{},
+	}
+
+	for name, fromType := range from {
+		toType, ok := to[name]
+		if !ok {
+			result.Removed[name] = fromType
+		} else if toType != fromType {
+			result.TypeChanged[name] = &entities.FieldTypeChange{From: fromType, To: toType}
+		}
+	}
+	for name, toType := range to {
+		if _, ok := from[name]; !ok {
+			result.Added[name] = toType
+		}
+	}
+	return result
+}
+
+func diffConditionTypes(from map[string]*ruleenginecore.ConditionType, to map[string]*ruleenginecore.ConditionType) (*entities.ConditionTypesDiff, error) {
+	result := &entities.ConditionTypesDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+
+	for name, fromType := range from {
+		toType, ok := to[name]
+		if !ok {
+			result.Removed = append(result.Removed, name)
+			continue
+		}
+
+		equal, err := canonicallyEqual(fromType, toType)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			result.Changed = append(result.Changed, name)
+		}
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			result.Added = append(result.Added, name)
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+	return result, nil
+}
+
+func diffRules(from map[string]*ruleenginecore.Rule, to map[string]*ruleenginecore.Rule) (*entities.RulesDiff, error) {
+	result := &entities.RulesDiff{Added: []string{}, Removed: []string{}, Changed: map[string]*entities.RuleChange{}}
+
+	for name, fromRule := range from {
+		toRule, ok := to[name]
+		if !ok {
+			result.Removed = append(result.Removed, name)
+			continue
+		}
+
+		change, err := diffRule(fromRule, toRule)
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			result.Changed[name] = change
+		}
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			result.Added = append(result.Added, name)
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	return result, nil
+}
+
+// diffRule of rule present in both configs, nil in case rule is unchanged
+func diffRule(from *ruleenginecore.Rule, to *ruleenginecore.Rule) (*entities.RuleChange, error) {
+	change := &entities.RuleChange{}
+	changed := false
+
+	if from.Priority != to.Priority {
+		change.Priority = &entities.PriorityChange{From: from.Priority, To: to.Priority}
+		changed = true
+	}
+
+	equal, err := canonicallyEqual(from.RootCondition, to.RootCondition)
+	if err != nil {
+		return nil, err
+	}
+	if !equal {
+		change.Condition = &entities.ConditionChange{From: from.RootCondition, To: to.RootCondition}
+		changed = true
+	}
+
+	if change.Result, err = diffResult(from.Result, to.Result); err != nil {
+		return nil, err
+	}
+	if change.Result != nil {
+		changed = true
+	}
+
+	if !changed {
+		return nil, nil
+	}
+	return change, nil
+}
+
+// diffResult of rule, nil in case result is unchanged
+func diffResult(from map[string]any, to map[string]any) (*entities.ResultChange, error) {
+	result := &entities.ResultChange{
+		Added:   map[string]any{},
+		Removed: map[string]any{},
+		Changed: map[string]*entities.ValueChange{},
+	}
+
+	for key, fromVal := range from {
+		toVal, ok := to[key]
+		if !ok {
+			result.Removed[key] = fromVal
+			continue
+		}
+
+		equal, err := canonicallyEqual(fromVal, toVal)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			result.Changed[key] = &entities.ValueChange{From: fromVal, To: toVal}
+		}
+	}
+	for key, toVal := range to {
+		if _, ok := from[key]; !ok {
+			result.Added[key] = toVal
+		}
+	}
+
+	if len(result.Added) == 0 && len(result.Removed) == 0 && len(result.Changed) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+func canonicallyEqual(a interface{}, b interface{}) (bool, error) {
+	canonicalA, err := digest.Canonical(a)
+	if err != nil {
+		return false, err
+	}
+	canonicalB, err := digest.Canonical(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(canonicalA, canonicalB), nil
+}
@@ -0,0 +1,122 @@
+package configdiff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/entities"
+)
+
+func configOf(t *testing.T, data string) *ruleenginecore.RuleEngineConfig {
+	t.Helper()
+	var config ruleenginecore.RuleEngineConfig
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("config unmarshal failed: %v", err)
+	}
+	return &config
+}
+
+const baseConfig = `{
+	"fields": {"amount": "int", "city": "string"},
+	"conditionTypes": {
+		"big": {"operator": ">", "operandType": "int", "operands": [{"operandAs": "field", "val": "amount"}, {"operandAs": "constant", "val": "100"}]},
+		"local": {"operator": "==", "operandType": "string", "operands": [{"operandAs": "field", "val": "city"}, {"operandAs": "constant", "val": "pune"}]}
+	},
+	"rules": {
+		"r1": {"priority": 1, "condition": {"conditionType": "big"}, "result": {"discount": 10, "tier": "gold"}},
+		"r2": {"priority": 2, "condition": {"conditionType": "local"}, "result": {"discount": 5}}
+	}
+}`
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name string
+		to   string
+		want *entities.ConfigDiff
+	}{
+		{
+			name: "identical",
+			to:   baseConfig,
+			want: &entities.ConfigDiff{
+				Fields:         &entities.FieldsDiff{Added: map[string]string{}, Removed: map[string]string{}, TypeChanged: map[string]*entities.FieldTypeChange{}},
+				ConditionTypes: &entities.ConditionTypesDiff{Added: []string{}, Removed: []string{}, Changed: []string{}},
+				Rules:          &entities.RulesDiff{Added: []string{}, Removed: []string{}, Changed: map[string]*entities.RuleChange{}},
+			},
+		},
+		{
+			name: "fields added, removed and type changed",
+			to: `{
+				"fields": {"amount": "float", "country": "string"},
+				"conditionTypes": {
+					"big": {"operator": ">", "operandType": "int", "operands": [{"operandAs": "field", "val": "amount"}, {"operandAs": "constant", "val": "100"}]},
+					"local": {"operator": "==", "operandType": "string", "operands": [{"operandAs": "field", "val": "city"}, {"operandAs": "constant", "val": "pune"}]}
+				},
+				"rules": {
+					"r1": {"priority": 1, "condition": {"conditionType": "big"}, "result": {"discount": 10, "tier": "gold"}},
+					"r2": {"priority": 2, "condition": {"conditionType": "local"}, "result": {"discount": 5}}
+				}
+			}`,
+			want: &entities.ConfigDiff{
+				Fields: &entities.FieldsDiff{
+					Added:       map[string]string{"country": "string"},
+					Removed:     map[string]string{"city": "string"},
+					TypeChanged: map[string]*entities.FieldTypeChange{"amount": {From: "int", To: "float"}},
+				},
+				ConditionTypes: &entities.ConditionTypesDiff{Added: []string{}, Removed: []string{}, Changed: []string{}},
+				Rules:          &entities.RulesDiff{Added: []string{}, Removed: []string{}, Changed: map[string]*entities.RuleChange{}},
+			},
+		},
+		{
+			name: "conditionTypes and rules added, removed and changed",
+			to: `{
+				"fields": {"amount": "int", "city": "string"},
+				"conditionTypes": {
+					"big": {"operator": ">", "operandType": "int", "operands": [{"operandAs": "field", "val": "amount"}, {"operandAs": "constant", "val": "500"}]},
+					"small": {"operator": "<=", "operandType": "int", "operands": [{"operandAs": "field", "val": "amount"}, {"operandAs": "constant", "val": "100"}]}
+				},
+				"rules": {
+					"r1": {"priority": 3, "condition": {"conditionType": "small"}, "result": {"discount": 20, "bonus": true}},
+					"r3": {"priority": 2, "condition": {"conditionType": "big"}, "result": {"discount": 5}}
+				}
+			}`,
+			want: &entities.ConfigDiff{
+				Fields:         &entities.FieldsDiff{Added: map[string]string{}, Removed: map[string]string{}, TypeChanged: map[string]*entities.FieldTypeChange{}},
+				ConditionTypes: &entities.ConditionTypesDiff{Added: []string{"small"}, Removed: []string{"local"}, Changed: []string{"big"}},
+				Rules: &entities.RulesDiff{
+					Added:   []string{"r3"},
+					Removed: []string{"r2"},
+					Changed: map[string]*entities.RuleChange{
+						"r1": {
+							Priority: &entities.PriorityChange{From: 1, To: 3},
+							Condition: &entities.ConditionChange{
+								From: &ruleenginecore.Condition{ConditionType: "big"},
+								To:   &ruleenginecore.Condition{ConditionType: "small"},
+							},
+							Result: &entities.ResultChange{
+								Added:   map[string]any{"bonus": true},
+								Removed: map[string]any{"tier": "gold"},
+								Changed: map[string]*entities.ValueChange{"discount": {From: float64(10), To: float64(20)}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Of(configOf(t, baseConfig), configOf(t, tt.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Errorf("Of() = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
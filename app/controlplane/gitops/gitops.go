@@ -0,0 +1,266 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/niharrathod/ruleengine/app/audit"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/controlplane/service"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+
+	// audit actor of reconciliations
+	actor = "gitops"
+)
+
+// Reconciler keeps RuleEngines in sync with spec files of a directory, e.g. checked out from git.
+//
+// Directory is reconciled on start and on every interval against datastore, so that drift introduced through APIs is
+// reverted as well as file changes are applied. RuleEngines without file are left as is.
+// Every file is reconciled on its own, i.e. invalid file does not hold back others.
+type Reconciler struct {
+	dir      string
+	interval time.Duration
+	svc      *service.Service
+
+	mutex  sync.RWMutex
+	status *entities.GitOpsStatus
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+type specFile struct {
+	name string
+	data []byte
+}
+
+func New(svc *service.Service) *Reconciler {
+	interval := time.Duration(config.GitOps.IntervalSec) * time.Second
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	return &Reconciler{
+		dir:      config.GitOps.Dir,
+		interval: interval,
+		svc:      svc,
+		status:   &entities.GitOpsStatus{Dir: config.GitOps.Dir, Files: []*entities.GitOpsFileStatus{}},
+		done:     make(chan struct{}),
+	}
+}
+
+// Start reconciles directory and keeps watching it for file changes in background.
+func (r *Reconciler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	log.Logger.Info("GitOps reconciler starting", zap.String("Dir", r.dir), zap.Duration("Interval", r.interval))
+	r.reconcileAll(ctx)
+	go r.run(ctx)
+}
+
+// Stop stops reconciler, waits for in-progress reconciliation to finish or ctx to be done.
+func (r *Reconciler) Stop(ctx context.Context) {
+	log.Logger.Info("GitOps reconciler stopping")
+	r.cancel()
+
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		log.Logger.Error("GitOps reconciler stop timed out")
+	}
+}
+
+// Status of last reconciliation
+func (r *Reconciler) Status() *entities.GitOpsStatus {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.status
+}
+
+func (r *Reconciler) run(ctx context.Context) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		r.reconcileAll(ctx)
+	}
+}
+
+// reconcileAll reconciles every file, RuleEngine already in sync is not written.
+func (r *Reconciler) reconcileAll(ctx context.Context) {
+	files, err := readDir(r.dir)
+	if err != nil {
+		log.Logger.Error("GitOps directory read failed", zap.String("Dir", r.dir), zap.String("error", err.Error()))
+		return
+	}
+
+	ctx = audit.NewContext(ctx, &audit.Origin{Actor: actor, RequestID: primitive.NewObjectID().Hex()})
+	status := &entities.GitOpsStatus{Dir: r.dir, LastReconcileTime: time.Now().Unix(), Files: []*entities.GitOpsFileStatus{}}
+	declaredBy := map[string]string{}
+	for _, file := range files {
+		status.Files = append(status.Files, r.reconcile(ctx, file, declaredBy))
+	}
+
+	r.mutex.Lock()
+	r.status = status
+	r.mutex.Unlock()
+}
+
+// reconcile RuleEngine of file, declaredBy is map of RuleEngine name and file which declared it so far
+func (r *Reconciler) reconcile(ctx context.Context, file *specFile, declaredBy map[string]string) *entities.GitOpsFileStatus {
+	status := &entities.GitOpsFileStatus{File: file.name}
+
+	spec, err := parseSpec(file)
+	if err != nil {
+		status.Status = entities.GitOpsInvalid
+		status.Error = entities.NewErrorWithMsg(entities.ErrCodeParsingFailed, err.Error())
+		log.Logger.Error("GitOps file parsing failed", zap.String("File", file.name), zap.String("error", err.Error()))
+		return status
+	}
+	status.RuleEngine = spec.Name
+
+	if other, ok := declaredBy[spec.Name]; ok {
+		status.Status = entities.GitOpsInvalid
+		status.Error = entities.NewErrorWithMsg(entities.ErrCodeRuleEngineAlreadyExist, "ruleEngine:"+spec.Name+" is declared by "+other)
+		log.Logger.Error("GitOps RuleEngine declared twice", zap.String("File", file.name), zap.String("RuleEngine", spec.Name))
+		return status
+	}
+	declaredBy[spec.Name] = file.name
+
+	drift, reconcileErr := r.svc.ReconcileSpec(ctx, spec)
+	if reconcileErr != nil {
+		status.Status = entities.GitOpsInvalid
+		if reconcileErr.ErrCode == entities.ErrCodeDatastoreFailed {
+			status.Status = entities.GitOpsFailed
+		}
+		status.Error = reconcileErr
+		log.Logger.Error("GitOps reconcile failed", zap.String("File", file.name), zap.String("RuleEngine", spec.Name), zap.String("error", reconcileErr.Error()))
+		return status
+	}
+
+	status.Status = entities.GitOpsInSync
+	if len(drift) != 0 {
+		status.Status = entities.GitOpsReconciled
+		status.Drift = drift
+		log.Logger.Info("GitOps RuleEngine reconciled", zap.String("File", file.name), zap.String("RuleEngine", spec.Name), zap.Int("Steps", len(drift)))
+	}
+	return status
+}
+
+// readDir reads spec files of dir ordered by name
+func readDir(dir string) ([]*specFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []*specFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || !isSpecFile(entry.Name()) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, &specFile{name: entry.Name(), data: data})
+	}
+	return files, nil
+}
+
+func isSpecFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yml", ".yaml", ".json":
+		return true
+	}
+	return false
+}
+
+// parseSpec of yaml or json file, RuleEngine name defaults to file name without extension.
+// yaml is converted to json, so that both are decoded alike and unknown fields are rejected.
+func parseSpec(file *specFile) (*entities.RuleEngineSpec, error) {
+	data := file.data
+	if strings.ToLower(filepath.Ext(file.name)) != ".json" {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+
+		converted, err := jsonCompatible(doc)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(converted); err != nil {
+			return nil, err
+		}
+	}
+
+	var spec entities.RuleEngineSpec
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, err
+	}
+
+	if spec.Name == "" {
+		spec.Name = strings.TrimSuffix(file.name, filepath.Ext(file.name))
+	}
+	return &spec, nil
+}
+
+// jsonCompatible converts yaml maps, which are keyed by interface{}, to maps keyed by string
+func jsonCompatible(val interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			keyStr, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v must be string", key)
+			}
+			convertedItem, err := jsonCompatible(item)
+			if err != nil {
+				return nil, err
+			}
+			converted[keyStr] = convertedItem
+		}
+		return converted, nil
+	case []interface{}:
+		converted := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			convertedItem, err := jsonCompatible(item)
+			if err != nil {
+				return nil, err
+			}
+			converted = append(converted, convertedItem)
+		}
+		return converted, nil
+	}
+	return val, nil
+}
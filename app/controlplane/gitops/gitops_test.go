@@ -0,0 +1,208 @@
+package gitops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/controlplane/service"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// bulkConfigJSON gives discount on ordering at least 10 items
+const bulkConfigJSON = `{"fields":{"quantity":"int"},"conditionTypes":{"bulk":{"operator":">=","operandType":"int","operands":[{"operandAs":"field","val":"quantity"},{"operandAs":"constant","val":"10"}]}},"rules":{"bulk":{"priority":1,"condition":{"conditionType":"bulk"},"result":{"discount":5}}}}`
+
+const testSpecJSON = `{"defaultTag":"v1","tags":{"v1":{"isEnable":true,"config":` + bulkConfigJSON + `}},"aliases":{"stable":"v1"}}`
+
+const testSpecYAML = `
+name: cart
+defaultTag: v1
+tags:
+  v1:
+    isEnable: true
+    config:
+      fields:
+        quantity: int
+      conditionTypes:
+        bulk:
+          operator: ">="
+          operandType: int
+          operands:
+            - operandAs: field
+              val: quantity
+            - operandAs: constant
+              val: "10"
+      rules:
+        bulk:
+          priority: 1
+          condition:
+            conditionType: bulk
+          result:
+            discount: 5
+`
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		data     string
+		wantName string
+		wantErr  bool
+	}{
+		{"json named by file", "shop.json", testSpecJSON, "shop", false},
+		{"yaml with name", "other.yaml", testSpecYAML, "cart", false},
+		{"yaml of json", "shop.yml", testSpecJSON, "shop", false},
+		{"unknown field", "shop.json", `{"defaultTag":"v1","tag":{}}`, "", true},
+		{"unknown yaml field", "shop.yaml", "defaultTag: v1\ntag: {}\n", "", true},
+		{"non string key", "shop.yaml", "tags:\n  1: {}\n", "", true},
+		{"malformed", "shop.json", `{"defaultTag":`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseSpec(&specFile{name: tt.file, data: []byte(tt.data)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSpec() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if spec.Name != tt.wantName || spec.DefaultTag != "v1" || spec.Tags["v1"] == nil || spec.Tags["v1"].Config == nil {
+				t.Errorf("parseSpec() = %+v", spec)
+			}
+			if err := spec.Tags["v1"].Config.Validate(); err != nil {
+				t.Errorf("parsed config is invalid: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsSpecFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"shop.json", true},
+		{"shop.yaml", true},
+		{"shop.YML", true},
+		{"README.md", false},
+		{"shop", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSpecFile(tt.name); got != tt.want {
+				t.Errorf("isSpecFile(%v) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcileAll(t *testing.T) {
+	log.Logger = zap.NewNop()
+	config.Datastore = &config.DatastoreConf{Memory: &config.MemoryConf{}}
+	store, err := datastore.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := service.New(store, registry.New(store))
+
+	// files are reconciled in name order, hence shop is declared by duplicate.json first and shop.json is rejected
+	dir := t.TempDir()
+	files := map[string]string{
+		"shop.json":      testSpecJSON,
+		"cart.yaml":      testSpecYAML,
+		"duplicate.json": `{"name":"shop","defaultTag":"v1","tags":{"v1":{"isEnable":true,"config":` + bulkConfigJSON + `}}}`,
+		"invalid.json":   `{"defaultTag":"v2","tags":{"v1":{"isEnable":true,"config":` + bulkConfigJSON + `}}}`,
+		"broken.json":    `{`,
+		"notes.txt":      `not a spec`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config.GitOps = &config.GitOpsConf{Dir: dir}
+	r := New(svc)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		drift      func() *entities.Error
+		wantStatus map[string]string
+	}{
+		{
+			name:  "first reconciliation",
+			drift: func() *entities.Error { return nil },
+			wantStatus: map[string]string{
+				"broken.json":    entities.GitOpsInvalid,
+				"cart.yaml":      entities.GitOpsReconciled,
+				"duplicate.json": entities.GitOpsReconciled,
+				"invalid.json":   entities.GitOpsInvalid,
+				"shop.json":      entities.GitOpsInvalid,
+			},
+		},
+		{
+			name:  "in sync",
+			drift: func() *entities.Error { return nil },
+			wantStatus: map[string]string{
+				"broken.json":    entities.GitOpsInvalid,
+				"cart.yaml":      entities.GitOpsInSync,
+				"duplicate.json": entities.GitOpsInSync,
+				"invalid.json":   entities.GitOpsInvalid,
+				"shop.json":      entities.GitOpsInvalid,
+			},
+		},
+		{
+			name:  "drift through API reverted",
+			drift: func() *entities.Error { return svc.SetAlias(ctx, "cart", "canary", "v1") },
+			wantStatus: map[string]string{
+				"broken.json":    entities.GitOpsInvalid,
+				"cart.yaml":      entities.GitOpsReconciled,
+				"duplicate.json": entities.GitOpsInSync,
+				"invalid.json":   entities.GitOpsInvalid,
+				"shop.json":      entities.GitOpsInvalid,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.drift(); err != nil {
+				t.Fatal(err)
+			}
+			r.reconcileAll(ctx)
+
+			status := r.Status()
+			if len(status.Files) != len(tt.wantStatus) {
+				t.Fatalf("%v files reconciled, want %v", len(status.Files), len(tt.wantStatus))
+			}
+			for _, fileStatus := range status.Files {
+				if want := tt.wantStatus[fileStatus.File]; fileStatus.Status != want {
+					t.Errorf("file %v status %v, want %v, error %v", fileStatus.File, fileStatus.Status, want, fileStatus.Error)
+				}
+				if (fileStatus.Status == entities.GitOpsReconciled) != (len(fileStatus.Drift) != 0) {
+					t.Errorf("file %v status %v with drift %v", fileStatus.File, fileStatus.Status, fileStatus.Drift)
+				}
+			}
+		})
+	}
+
+	ruleEngine, dsErr := store.GetRuleEngine(ctx, "cart")
+	if dsErr != nil || ruleEngine == nil {
+		t.Fatalf("GetRuleEngine() = %v, %v", ruleEngine, dsErr)
+	}
+	if len(ruleEngine.Aliases) != 0 || ruleEngine.DefaultTag != "v1" {
+		t.Errorf("drift not reverted, %+v", ruleEngine)
+	}
+
+	events, _ := store.ListAuditEvents(ctx, "cart", primitive.NilObjectID, 1)
+	if len(events) != 1 || events[0].Actor != actor || events[0].Operation != entities.AuditOpDeleteAlias {
+		t.Errorf("unexpected audit events %+v", events)
+	}
+}
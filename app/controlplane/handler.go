@@ -5,13 +5,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/controlplane/gitops"
 	"github.com/niharrathod/ruleengine/app/controlplane/service"
 	"github.com/niharrathod/ruleengine/app/entities"
 	"github.com/niharrathod/ruleengine/app/log"
 	"go.uber.org/zap/zapcore"
 )
 
-func CreateRuleEngine() gin.HandlerFunc {
+func CreateRuleEngine(svc *service.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ruleEngineName := ctx.Param("ruleengine")
 		tag := ctx.Param("tag")
@@ -21,7 +22,7 @@ func CreateRuleEngine() gin.HandlerFunc {
 			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
 			return
 		}
-		if err := service.CreateRuleEngine(ctx, ruleEngineName, tag, &config); err != nil {
+		if err := svc.CreateRuleEngine(ctx, ruleEngineName, tag, &config); err != nil {
 			setResponse(ctx, err)
 			return
 		}
@@ -29,23 +30,206 @@ func CreateRuleEngine() gin.HandlerFunc {
 	}
 }
 
-func GetRuleEngine() gin.HandlerFunc {
+func CloneTag(svc *service.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ruleEngineName := ctx.Param("ruleengine")
+		tag := ctx.Param("tag")
+		var request entities.CloneRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal clone request", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		if err := svc.CloneTag(ctx, ruleEngineName, tag, &request); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
 
-		ruleEngine, err := service.GetCompleteRuleEngine(ctx, ruleEngineName)
+func RenameRuleEngine(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		var request entities.RenameRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal rename request", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		if err := svc.RenameRuleEngine(ctx, ruleEngineName, &request); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func RenameTag(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		tag := ctx.Param("tag")
+		var request entities.RenameRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal rename request", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		if err := svc.RenameTag(ctx, ruleEngineName, tag, &request); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func UpdateTagConfig(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		tag := ctx.Param("tag")
+		var config ruleenginecore.RuleEngineConfig
+		if err := ctx.BindJSON(&config); err != nil {
+			log.Logger.Error("Could not unmarshal RuleEngineConfig", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		if err := svc.UpdateTagConfig(ctx, ruleEngineName, tag, &config); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func GetRuleEngine(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+
+		var ruleEngine *entities.CompleteRuleEngine
+		var err *entities.Error
+		switch ctx.Query("fields") {
+		case "":
+			ruleEngine, err = svc.GetCompleteRuleEngine(ctx, ruleEngineName)
+		case "summary":
+			ruleEngine, err = svc.GetRuleEngineSummary(ctx, ruleEngineName)
+		default:
+			err = entities.NewError(entities.ErrCodeInvalidFieldsQuery)
+		}
 		if err != nil {
 			setResponse(ctx, err)
+			return
 		}
 
 		ctx.JSON(http.StatusOK, ruleEngine)
 	}
 }
 
-func DeleteRuleEngine() gin.HandlerFunc {
+func GetTag(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		tag := ctx.Param("tag")
+
+		tagResponse, err := svc.GetTag(ctx, ruleEngineName, tag)
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusOK, tagResponse)
+	}
+}
+
+func ListRuleEngines(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngines, err := svc.ListRuleEngines(ctx, ctx.Query("prefix"), ctx.Query("sort"), ctx.Query("order"), ctx.Query("limit"), ctx.Query("cursor"))
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, ruleEngines)
+	}
+}
+
+func Export(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		archive, err := svc.Export(ctx, ctx.Query("ruleEngines"))
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, archive)
+	}
+}
+
+func Import(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var archive entities.RuleEngineArchive
+		if err := ctx.BindJSON(&archive); err != nil {
+			log.Logger.Error("Could not unmarshal RuleEngineArchive", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		result, err := svc.Import(ctx, &archive, ctx.Query("policy"))
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, result)
+	}
+}
+
+func Apply(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		var request entities.ApplyRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal apply request", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		plan, err := svc.Apply(ctx, ruleEngineName, &request, ctx.Query("dryRun"))
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, plan)
+	}
+}
+
+func GitOpsStatus(reconciler *gitops.Reconciler) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, reconciler.Status())
+	}
+}
+
+func DeleteRuleEngine(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		if err := svc.DeleteRuleEngine(ctx, ruleEngineName); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func DeleteRuleEngineConfig(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		tag := ctx.Param("tag")
+		if err := svc.DeleteRuleEngineConfig(ctx, ruleEngineName, tag); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func SetDefaultTag(svc *service.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ruleEngineName := ctx.Param("ruleengine")
-		if err := service.DeleteRuleEngine(ctx, ruleEngineName); err != nil {
+		tag := ctx.Param("tag")
+		if err := svc.SetDefaultTag(ctx, ruleEngineName, tag); err != nil {
 			setResponse(ctx, err)
 			return
 		}
@@ -53,11 +237,34 @@ func DeleteRuleEngine() gin.HandlerFunc {
 	}
 }
 
-func DeleteRuleEngineConfig() gin.HandlerFunc {
+func RemoveDefaultTag(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		if err := svc.RemoveDefaultTag(ctx, ruleEngineName); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func RollbackDefaultTag(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		response, err := svc.RollbackDefaultTag(ctx, ruleEngineName)
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+func EnableRuleEngine(svc *service.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ruleEngineName := ctx.Param("ruleengine")
 		tag := ctx.Param("tag")
-		if err := service.DeleteRuleEngineConfig(ctx, ruleEngineName, tag); err != nil {
+		if err := svc.EnableRuleEngine(ctx, ruleEngineName, tag); err != nil {
 			setResponse(ctx, err)
 			return
 		}
@@ -65,11 +272,11 @@ func DeleteRuleEngineConfig() gin.HandlerFunc {
 	}
 }
 
-func SetDefaultTag() gin.HandlerFunc {
+func DisableRuleEngine(svc *service.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ruleEngineName := ctx.Param("ruleengine")
 		tag := ctx.Param("tag")
-		if err := service.SetDefaultTag(ctx, ruleEngineName, tag); err != nil {
+		if err := svc.DisableRuleEngine(ctx, ruleEngineName, tag); err != nil {
 			setResponse(ctx, err)
 			return
 		}
@@ -77,10 +284,60 @@ func SetDefaultTag() gin.HandlerFunc {
 	}
 }
 
-func RemoveDefaultTag() gin.HandlerFunc {
+func SetAlias(svc *service.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ruleEngineName := ctx.Param("ruleengine")
-		if err := service.RemoveDefaultTag(ctx, ruleEngineName); err != nil {
+		alias := ctx.Param("alias")
+		var request entities.AliasRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal alias request", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		if err := svc.SetAlias(ctx, ruleEngineName, alias, request.Tag); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func GetAlias(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		alias := ctx.Param("alias")
+
+		aliasResponse, err := svc.GetAlias(ctx, ruleEngineName, alias)
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, aliasResponse)
+	}
+}
+
+func DeleteAlias(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		alias := ctx.Param("alias")
+		if err := svc.DeleteAlias(ctx, ruleEngineName, alias); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func SetTrafficSplit(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		var request entities.TrafficSplitRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal traffic split request", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		if err := svc.SetTrafficSplit(ctx, ruleEngineName, request.Tags); err != nil {
 			setResponse(ctx, err)
 			return
 		}
@@ -88,11 +345,28 @@ func RemoveDefaultTag() gin.HandlerFunc {
 	}
 }
 
-func EnableRuleEngine() gin.HandlerFunc {
+func RemoveTrafficSplit(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		if err := svc.RemoveTrafficSplit(ctx, ruleEngineName); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func SetTagSchedule(svc *service.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ruleEngineName := ctx.Param("ruleengine")
 		tag := ctx.Param("tag")
-		if err := service.EnableRuleEngine(ctx, ruleEngineName, tag); err != nil {
+		var request entities.ScheduleRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal schedule request", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		if err := svc.SetTagSchedule(ctx, ruleEngineName, tag, &request); err != nil {
 			setResponse(ctx, err)
 			return
 		}
@@ -100,11 +374,39 @@ func EnableRuleEngine() gin.HandlerFunc {
 	}
 }
 
-func DisableRuleEngine() gin.HandlerFunc {
+func RemoveTagSchedule(svc *service.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		ruleEngineName := ctx.Param("ruleengine")
 		tag := ctx.Param("tag")
-		if err := service.DisableRuleEngine(ctx, ruleEngineName, tag); err != nil {
+		if err := svc.RemoveTagSchedule(ctx, ruleEngineName, tag); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func SetShadowTag(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		var request entities.ShadowRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal shadow request", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+		if err := svc.SetShadowTag(ctx, ruleEngineName, request.Tag); err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	}
+}
+
+func RemoveShadowTag(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		if err := svc.RemoveShadowTag(ctx, ruleEngineName); err != nil {
 			setResponse(ctx, err)
 			return
 		}
@@ -112,10 +414,47 @@ func DisableRuleEngine() gin.HandlerFunc {
 	}
 }
 
+func ListShadowDisagreements(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		disagreements, err := svc.ListShadowDisagreements(ctx, ruleEngineName, ctx.Query("limit"), ctx.Query("cursor"))
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, disagreements)
+	}
+}
+
+func GetHistory(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		history, err := svc.GetHistory(ctx, ruleEngineName, ctx.Query("limit"), ctx.Query("cursor"))
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, history)
+	}
+}
+
+func GetDiff(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		diff, err := svc.GetDiff(ctx, ruleEngineName, ctx.Query("from"), ctx.Query("to"))
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, diff)
+	}
+}
+
 func setResponse(ctx *gin.Context, err *entities.Error) {
 	switch err.ErrCode {
 	case entities.ErrCodeRuleEngineNotFound,
-		entities.ErrCodeTagNotFound:
+		entities.ErrCodeTagNotFound,
+		entities.ErrCodeAliasNotFound:
 		ctx.JSON(http.StatusNotFound, err)
 		return
 	case entities.ErrCodeParsingFailed,
@@ -124,8 +463,24 @@ func setResponse(ctx *gin.Context, err *entities.Error) {
 		entities.ErrCodeInvalidRuleEngineConfig,
 		entities.ErrCodeTagDeleteNotAllowed,
 		entities.ErrCodeTagDisableNotAllowed,
+		entities.ErrCodeTagUpdateNotAllowed,
 		entities.ErrCodeDefaultTagExistAndMustBeEnabled,
-		entities.ErrCodeTagAlreadyExist:
+		entities.ErrCodeTagAlreadyExist,
+		entities.ErrCodeInvalidListQuery,
+		entities.ErrCodeInvalidFieldsQuery,
+		entities.ErrCodeInvalidAliasName,
+		entities.ErrCodeAliasTagMustBeEnabled,
+		entities.ErrCodeAliasConflict,
+		entities.ErrCodeInvalidTrafficSplit,
+		entities.ErrCodeShadowTagMustBeEnabled,
+		entities.ErrCodeInvalidPageQuery,
+		entities.ErrCodeInvalidSchedule,
+		entities.ErrCodeNoPreviousDefaultTag,
+		entities.ErrCodePreviousDefaultTagDeleted,
+		entities.ErrCodeInvalidDiffQuery,
+		entities.ErrCodeRuleEngineAlreadyExist,
+		entities.ErrCodeInvalidImport,
+		entities.ErrCodeInvalidApplyQuery:
 		ctx.JSON(http.StatusBadRequest, err)
 		return
 	case entities.ErrCodeDatastoreFailed:
@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/niharrathod/ruleengine/app/audit"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInterval = 5 * time.Second
+
+	// audit actor of applied schedules
+	actor = "scheduler"
+)
+
+// Scheduler applies due tag activations and expiries of RuleEngines.
+//
+// Every replica runs a scheduler, datastore applies schedule transactionally and only once,
+// i.e. replica which finds nothing due anymore skips the RuleEngine.
+type Scheduler struct {
+	interval time.Duration
+	store    datastore.Store
+	registry *registry.Registry
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func New(store datastore.Store, r *registry.Registry) *Scheduler {
+	interval := time.Duration(config.Scheduler.IntervalSec) * time.Second
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	return &Scheduler{
+		interval: interval,
+		store:    store,
+		registry: r,
+		done:     make(chan struct{}),
+	}
+}
+
+// Start applies schedules due by now and keeps applying them in background.
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	log.Logger.Info("Scheduler starting", zap.Duration("Interval", s.interval))
+	go s.run(ctx)
+}
+
+// Stop stops scheduler, waits for in-progress run to finish or ctx to be done.
+func (s *Scheduler) Stop(ctx context.Context) {
+	log.Logger.Info("Scheduler stopping")
+	s.cancel()
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		log.Logger.Error("Scheduler stop timed out")
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.applyDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyDue applies schedules of every RuleEngine due by now, and refreshes registry of changed RuleEngines.
+func (s *Scheduler) applyDue(ctx context.Context) {
+	ctx = audit.NewContext(ctx, &audit.Origin{Actor: actor, RequestID: primitive.NewObjectID().Hex()})
+	now := time.Now().Unix()
+	ruleEngines, err := s.store.GetRuleEnginesScheduledBy(ctx, now)
+	if err != nil {
+		log.Logger.Error("Get scheduled RuleEngines failed", zap.String("error", err.Error()))
+		return
+	}
+
+	for _, ruleEngine := range ruleEngines {
+		changed, err := s.store.ApplySchedule(ctx, ruleEngine.Name, now)
+		if err != nil {
+			log.Logger.Error("Apply schedule failed", zap.String("RuleEngine", ruleEngine.Name), zap.String("error", err.Error()))
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+		if err := s.registry.Refresh(ctx, ruleEngine.Name); err != nil {
+			log.Logger.Error("RuleEngine registry refresh failed", zap.String("RuleEngine", ruleEngine.Name), zap.String("error", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+func TestApplyDue(t *testing.T) {
+	log.Logger = zap.NewNop()
+	config.Datastore = &config.DatastoreConf{Memory: &config.MemoryConf{}}
+	config.Scheduler = &config.SchedulerConf{}
+	store, err := datastore.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleEngines := registry.New(store)
+	s := New(store, ruleEngines)
+
+	// shipping is charged below minimum cart value
+	shipping := &ruleenginecore.RuleEngineConfig{
+		Fields: ruleenginecore.Fields{"cartValue": "float"},
+		ConditionTypes: map[string]*ruleenginecore.ConditionType{
+			"small": {Operator: "<", OperandType: "float", Operands: []*ruleenginecore.Operand{
+				{OperandAs: "field", Val: "cartValue"},
+				{OperandAs: "constant", Val: "49.99"},
+			}},
+		},
+		Rules: map[string]*ruleenginecore.Rule{
+			"shipping": {Priority: 1, RootCondition: &ruleenginecore.Condition{ConditionType: "small"}, Result: map[string]any{"fee": 4.99}},
+		},
+	}
+
+	ctx := context.Background()
+	now := time.Now().Unix()
+	steps := []func() *entities.Error{
+		func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", shipping) },
+		func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v2", shipping) },
+		func() *entities.Error { return store.EnableTag(ctx, "shop", "v1") },
+		func() *entities.Error { return store.SetDefaultTag(ctx, "shop", "v1") },
+		func() *entities.Error { return store.SetTagSchedule(ctx, "shop", "v2", now-1, 0) },
+		func() *entities.Error { return store.CreateRuleEngine(ctx, "cart", "v1", shipping) },
+		func() *entities.Error { return store.SetTagSchedule(ctx, "cart", "v1", now+3600, 0) },
+		func() *entities.Error { return ruleEngines.Refresh(ctx, "shop") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ruleEngine  string
+		wantDefault string
+	}{
+		{"shop", "v2"},
+		{"cart", ""},
+	}
+
+	// applying again finds nothing due, i.e. schedule is applied once
+	for run := 0; run < 2; run++ {
+		s.applyDue(ctx)
+		for _, tt := range tests {
+			ruleEngine, err := store.GetRuleEngine(ctx, tt.ruleEngine)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ruleEngine.DefaultTag != tt.wantDefault {
+				t.Errorf("run %v, %v default = %v, want %v", run, tt.ruleEngine, ruleEngine.DefaultTag, tt.wantDefault)
+			}
+		}
+
+		events, _ := store.ListAuditEvents(ctx, "shop", primitive.NilObjectID, 100)
+		activations := 0
+		for _, event := range events {
+			if event.Operation == entities.AuditOpScheduledActivation {
+				activations++
+			}
+		}
+		if events[0].Operation != entities.AuditOpScheduledActivation || events[0].Actor != actor || activations != 1 {
+			t.Errorf("run %v, last audit event %+v, %v activations audited, want 1", run, events[0], activations)
+		}
+	}
+
+	// registry of changed RuleEngine is refreshed
+	if tag, _, err := ruleEngines.Get("shop", "", ""); err != nil || tag != "v2" {
+		t.Errorf("registry Get() = %v, %v, want v2", tag, err)
+	}
+}
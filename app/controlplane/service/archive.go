@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/validator"
+)
+
+// Export archives RuleEngines along with every tag config, enable state, default tag, aliases, traffic split and shadow tag.
+// ruleEngineNames is comma separated, empty as every RuleEngine. Each RuleEngine is read consistently, archive as a whole is not.
+func (s *Service) Export(ctx context.Context, ruleEngineNames string) (*entities.RuleEngineArchive, *entities.Error) {
+	var names []string
+	if ruleEngineNames == "" {
+		var err *entities.Error
+		if names, err = s.store.GetRuleEngineNames(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		names = strings.Split(ruleEngineNames, ",")
+	}
+	sort.Strings(names)
+
+	archive := &entities.RuleEngineArchive{ExportTime: time.Now().Unix(), RuleEngines: []*entities.RuleEngineSpec{}}
+	for _, name := range names {
+		if !validator.IsAlphanumericMax30(name) {
+			return nil, entities.NewErrorWithMsg(entities.ErrCodeInvalidRuleEngineName, "ruleEngine:"+name)
+		}
+
+		ruleEngine, err := s.store.GetCompleteRuleEngine(ctx, name)
+		if err != nil {
+			if err.ErrCode == entities.ErrCodeRuleEngineNotFound {
+				return nil, entities.NewErrorWithMsg(entities.ErrCodeRuleEngineNotFound, "ruleEngine:"+name)
+			}
+			return nil, err
+		}
+		archive.RuleEngines = append(archive.RuleEngines, specOf(ruleEngine))
+	}
+	return archive, nil
+}
+
+// Import validates every RuleEngine of archive and imports them all or nothing, existing RuleEngine is handled as per policy.
+func (s *Service) Import(ctx context.Context, archive *entities.RuleEngineArchive, policy string) (*entities.ImportResult, *entities.Error) {
+	if policy == "" {
+		policy = entities.ImportPolicyFail
+	}
+	if policy != entities.ImportPolicySkip && policy != entities.ImportPolicyOverwrite && policy != entities.ImportPolicyFail {
+		return nil, entities.NewError(entities.ErrCodeInvalidImport)
+	}
+
+	seen := map[string]bool{}
+	for _, spec := range archive.RuleEngines {
+		if spec == nil {
+			return nil, entities.NewError(entities.ErrCodeInvalidImport)
+		}
+		if err := validateSpec(spec); err != nil {
+			return nil, err
+		}
+		if seen[spec.Name] {
+			return nil, entities.NewErrorWithMsg(entities.ErrCodeInvalidImport, "ruleEngine:"+spec.Name+" is repeated")
+		}
+		seen[spec.Name] = true
+	}
+
+	result, err := s.store.ImportRuleEngines(ctx, archive.RuleEngines, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, names := range [][]string{result.Created, result.Overwritten} {
+		for _, name := range names {
+			s.refreshRegistry(ctx, name)
+		}
+	}
+	return result, nil
+}
+
+// validateSpec checks names and configs of RuleEngine spec, rest of the invariants are enforced by datastore
+func validateSpec(spec *entities.RuleEngineSpec) *entities.Error {
+	if !validator.IsAlphanumericMax30(spec.Name) {
+		return entities.NewErrorWithMsg(entities.ErrCodeInvalidRuleEngineName, "ruleEngine:"+spec.Name)
+	}
+	if len(spec.Tags) == 0 {
+		return entities.NewErrorWithMsg(entities.ErrCodeInvalidTagName, "ruleEngine:"+spec.Name+" at least one tag is required")
+	}
+
+	for tag, tagSpec := range spec.Tags {
+		if !validator.IsAlphanumericMax30(tag) {
+			return entities.NewErrorWithMsg(entities.ErrCodeInvalidTagName, "ruleEngine:"+spec.Name+" tag:"+tag)
+		}
+		if tagSpec == nil || tagSpec.Config == nil {
+			return entities.NewErrorWithMsg(entities.ErrCodeInvalidRuleEngineConfig, "ruleEngine:"+spec.Name+" tag:"+tag+" config is required")
+		}
+		if err := tagSpec.Config.Validate(); err != nil {
+			return entities.NewErrorWithMsg(entities.ErrCodeInvalidRuleEngineConfig, "ruleEngine:"+spec.Name+" tag:"+tag+" "+err.Error())
+		}
+	}
+
+	for alias := range spec.Aliases {
+		if !validator.IsAlphanumericMax30(alias) {
+			return entities.NewErrorWithMsg(entities.ErrCodeInvalidAliasName, "ruleEngine:"+spec.Name+" alias:"+alias)
+		}
+	}
+	return nil
+}
+
+// specOf RuleEngine, history and schedules are specific to environment hence not part of spec
+func specOf(ruleEngine *entities.CompleteRuleEngine) *entities.RuleEngineSpec {
+	spec := &entities.RuleEngineSpec{
+		Name:         ruleEngine.Name,
+		DefaultTag:   ruleEngine.DefaultTag,
+		Tags:         map[string]*entities.TagSpec{},
+		Aliases:      ruleEngine.Aliases,
+		TrafficSplit: ruleEngine.TrafficSplit,
+		ShadowTag:    ruleEngine.ShadowTag,
+	}
+	for tag, tagResponse := range ruleEngine.Tags {
+		spec.Tags[tag] = &entities.TagSpec{IsEnable: tagResponse.IsEnable, Config: tagResponse.Config}
+	}
+	return spec
+}
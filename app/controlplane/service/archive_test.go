@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/niharrathod/ruleengine/app/entities"
+)
+
+// testSpec has enabled default v1 aliased as stable and disabled v2
+func testSpec(name string) *entities.RuleEngineSpec {
+	return &entities.RuleEngineSpec{
+		Name:       name,
+		DefaultTag: "v1",
+		Tags: map[string]*entities.TagSpec{
+			"v1": {IsEnable: true, Config: tierConfig(10, "gold")},
+			"v2": {IsEnable: false, Config: tierConfig(20, "gold")},
+		},
+		Aliases: map[string]string{"stable": "v1"},
+	}
+}
+
+func TestValidateSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*entities.RuleEngineSpec)
+		wantErr uint
+	}{
+		{"valid", func(*entities.RuleEngineSpec) {}, 0},
+		{"invalid name", func(s *entities.RuleEngineSpec) { s.Name = "shop/1" }, entities.ErrCodeInvalidRuleEngineName},
+		{"without tags", func(s *entities.RuleEngineSpec) { s.Tags = nil }, entities.ErrCodeInvalidTagName},
+		{"invalid tag name", func(s *entities.RuleEngineSpec) { s.Tags["v 3"] = s.Tags["v2"] }, entities.ErrCodeInvalidTagName},
+		{"without config", func(s *entities.RuleEngineSpec) { s.Tags["v2"].Config = nil }, entities.ErrCodeInvalidRuleEngineConfig},
+		{"invalid config", func(s *entities.RuleEngineSpec) { s.Tags["v2"].Config = tierConfig(20, "silver") }, entities.ErrCodeInvalidRuleEngineConfig},
+		{"invalid alias name", func(s *entities.RuleEngineSpec) { s.Aliases["st-able"] = "v1" }, entities.ErrCodeInvalidAliasName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := testSpec("shop")
+			tt.modify(spec)
+			if err := validateSpec(spec); errCodeOf(err) != tt.wantErr {
+				t.Errorf("validateSpec() = %v, want errCode %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	source, _ := newTestService(t)
+	ctx := context.Background()
+	archive := &entities.RuleEngineArchive{RuleEngines: []*entities.RuleEngineSpec{testSpec("cart"), testSpec("shop")}}
+	if _, err := source.Import(ctx, archive, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := source.Export(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(exported.RuleEngines, archive.RuleEngines) {
+		t.Fatalf("Export() differs from imported archive")
+	}
+	if _, err := source.Export(ctx, "shop,missing"); errCodeOf(err) != entities.ErrCodeRuleEngineNotFound {
+		t.Errorf("Export() of missing RuleEngine = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		archive     *entities.RuleEngineArchive
+		policy      string
+		wantErr     uint
+		wantCreated []string
+	}{
+		{"into empty environment", exported, "", 0, []string{"cart", "shop"}},
+		{"invalid policy", exported, "merge", entities.ErrCodeInvalidImport, nil},
+		{"repeated RuleEngine", &entities.RuleEngineArchive{RuleEngines: []*entities.RuleEngineSpec{testSpec("shop"), testSpec("shop")}}, "", entities.ErrCodeInvalidImport, nil},
+		{"nil RuleEngine", &entities.RuleEngineArchive{RuleEngines: []*entities.RuleEngineSpec{nil}}, "", entities.ErrCodeInvalidImport, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, ruleEngines := newTestService(t)
+			result, err := target.Import(ctx, tt.archive, tt.policy)
+			if errCodeOf(err) != tt.wantErr {
+				t.Fatalf("Import() error = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr != 0 {
+				return
+			}
+			if !reflect.DeepEqual(result.Created, tt.wantCreated) {
+				t.Errorf("Import() created %v, want %v", result.Created, tt.wantCreated)
+			}
+			for _, name := range tt.wantCreated {
+				if tag, _, err := ruleEngines.Get(name, "stable", ""); err != nil || tag != "v1" {
+					t.Errorf("registry Get() of imported %v = %v, %v", name, tag, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/niharrathod/ruleengine/app/entities"
+)
+
+// Apply makes RuleEngine, created if not exist, as desired through a plan of changes executed all or nothing.
+// dryRun(true or false, empty as false) returns plan without executing it.
+func (s *Service) Apply(ctx context.Context, ruleEngineName string, request *entities.ApplyRequest, dryRun string) (*entities.ApplyPlan, *entities.Error) {
+	isDryRun := false
+	if dryRun != "" {
+		var err error
+		if isDryRun, err = strconv.ParseBool(dryRun); err != nil {
+			return nil, entities.NewError(entities.ErrCodeInvalidApplyQuery)
+		}
+	}
+
+	desired := &entities.RuleEngineSpec{Name: ruleEngineName, DefaultTag: request.DefaultTag, Tags: request.Tags, Aliases: request.Aliases, TrafficSplit: request.TrafficSplit}
+	if request.ShadowTag != nil {
+		desired.ShadowTag = *request.ShadowTag
+	}
+	if err := validateSpec(desired); err != nil {
+		return nil, err
+	}
+
+	// absent routing is kept as is
+	opts := &entities.ApplyOptions{
+		DryRun:           isDryRun,
+		KeepAliases:      request.Aliases == nil,
+		KeepTrafficSplit: request.TrafficSplit == nil,
+		KeepShadowTag:    request.ShadowTag == nil,
+	}
+	steps, err := s.store.ApplyRuleEngine(ctx, desired, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isDryRun && len(steps) != 0 {
+		s.refreshRegistry(ctx, ruleEngineName)
+	}
+	return &entities.ApplyPlan{RuleEngine: ruleEngineName, DryRun: isDryRun, Steps: steps}, nil
+}
+
+// ReconcileSpec validates spec and makes RuleEngine, created if not exist, match it through a plan of changes.
+// Routing is declared by spec as well, i.e. nothing is kept as is. Returns drift as executed plan, empty in case
+// RuleEngine was already in sync.
+func (s *Service) ReconcileSpec(ctx context.Context, spec *entities.RuleEngineSpec) ([]*entities.PlanStep, *entities.Error) {
+	if err := validateSpec(spec); err != nil {
+		return nil, err
+	}
+
+	steps, err := s.store.ApplyRuleEngine(ctx, spec, &entities.ApplyOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(steps) != 0 {
+		s.refreshRegistry(ctx, spec.Name)
+	}
+	return steps, nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/niharrathod/ruleengine/app/entities"
+)
+
+func TestApply(t *testing.T) {
+	svc, ruleEngines := newTestService(t)
+	ctx := context.Background()
+	request := func() *entities.ApplyRequest {
+		spec := testSpec("shop")
+		return &entities.ApplyRequest{DefaultTag: spec.DefaultTag, Tags: spec.Tags, Aliases: spec.Aliases}
+	}
+
+	if _, err := svc.Apply(ctx, "shop", request(), "maybe"); errCodeOf(err) != entities.ErrCodeInvalidApplyQuery {
+		t.Errorf("Apply() with invalid dryRun = %v", err)
+	}
+
+	plan, err := svc.Apply(ctx, "shop", request(), "true")
+	if err != nil || !plan.DryRun || len(plan.Steps) == 0 {
+		t.Fatalf("Apply() dry run = %+v, %v", plan, err)
+	}
+	if _, _, err := ruleEngines.Get("shop", "", ""); errCodeOf(err) != entities.ErrCodeRuleEngineNotFound {
+		t.Errorf("dry run reached registry, Get() = %v", err)
+	}
+
+	if plan, err = svc.Apply(ctx, "shop", request(), ""); err != nil || plan.DryRun || len(plan.Steps) == 0 {
+		t.Fatalf("Apply() = %+v, %v", plan, err)
+	}
+	if tag, _, err := ruleEngines.Get("shop", "stable", ""); err != nil || tag != "v1" {
+		t.Errorf("registry Get() after apply = %v, %v", tag, err)
+	}
+
+	// routing absent from request is kept as is
+	if err := svc.SetAlias(ctx, "shop", "canary", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	kept := request()
+	kept.Aliases = nil
+	if plan, err = svc.Apply(ctx, "shop", kept, ""); err != nil || len(plan.Steps) != 0 {
+		t.Errorf("Apply() without aliases = %+v, %v, want no steps", plan, err)
+	}
+}
+
+func TestReconcileSpec(t *testing.T) {
+	svc, ruleEngines := newTestService(t)
+	ctx := context.Background()
+
+	invalid := testSpec("shop")
+	invalid.Tags["v1"].Config = tierConfig(10, "silver")
+	if _, err := svc.ReconcileSpec(ctx, invalid); errCodeOf(err) != entities.ErrCodeInvalidRuleEngineConfig {
+		t.Errorf("ReconcileSpec() of invalid spec = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		drift  func() *entities.Error
+		wantOp []string
+	}{
+		{"created", func() *entities.Error { return nil }, []string{
+			entities.AuditOpCreateTag, entities.AuditOpCreateTag, entities.AuditOpEnableTag, entities.AuditOpSetDefaultTag, entities.AuditOpSetAlias,
+		}},
+		{"in sync", func() *entities.Error { return nil }, []string{}},
+		{"alias added through API", func() *entities.Error { return svc.SetAlias(ctx, "shop", "canary", "v1") }, []string{entities.AuditOpDeleteAlias}},
+		{"tag enabled through API", func() *entities.Error { return svc.EnableRuleEngine(ctx, "shop", "v2") }, []string{entities.AuditOpDisableTag}},
+		{"default removed through API", func() *entities.Error { return svc.RemoveDefaultTag(ctx, "shop") }, []string{entities.AuditOpSetDefaultTag}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.drift(); err != nil {
+				t.Fatal(err)
+			}
+			drift, err := svc.ReconcileSpec(ctx, testSpec("shop"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ops := []string{}
+			for _, step := range drift {
+				ops = append(ops, step.Operation)
+			}
+			if !reflect.DeepEqual(ops, tt.wantOp) {
+				t.Errorf("ReconcileSpec() = %v, want %v", ops, tt.wantOp)
+			}
+			if tag, _, err := ruleEngines.Get("shop", "", ""); err != nil || tag != "v1" {
+				t.Errorf("registry Get() after reconcile = %v, %v", tag, err)
+			}
+		})
+	}
+}
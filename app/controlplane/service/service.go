@@ -2,14 +2,117 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
 
 	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/configdiff"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	"github.com/niharrathod/ruleengine/app/digest"
 	"github.com/niharrathod/ruleengine/app/entities"
 	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
 	"github.com/niharrathod/ruleengine/app/validator"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
 )
 
-func CreateRuleEngine(ctx context.Context, ruleEngineName string, tag string, config *ruleenginecore.RuleEngineConfig) *entities.Error {
+// Service for control plane operations
+type Service struct {
+	store       datastore.Store
+	ruleEngines *registry.Registry
+}
+
+func New(store datastore.Store, ruleEngines *registry.Registry) *Service {
+	return &Service{store: store, ruleEngines: ruleEngines}
+}
+
+func (s *Service) CreateRuleEngine(ctx context.Context, ruleEngineName string, tag string, config *ruleenginecore.RuleEngineConfig) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(tag) {
+		return entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+	if err := config.Validate(); err != nil {
+		return entities.NewErrorWithMsg(entities.ErrCodeInvalidRuleEngineConfig, err.Error())
+	}
+
+	if err := s.store.CreateRuleEngine(ctx, ruleEngineName, tag, config); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+// CloneTag clones config of tag(name, alias or digest reference) as new disabled tag of target RuleEngine, target
+// RuleEngine defaults to source RuleEngine and is created if not exist. same checks as CreateRuleEngine are applied.
+func (s *Service) CloneTag(ctx context.Context, ruleEngineName string, tag string, request *entities.CloneRequest) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(tag) && !digest.IsReference(tag) {
+		return entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+
+	targetRuleEngineName := request.RuleEngine
+	if targetRuleEngineName == "" {
+		targetRuleEngineName = ruleEngineName
+	}
+	if !validator.IsAlphanumericMax30(targetRuleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(request.Tag) {
+		return entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+
+	if err := s.store.CloneTag(ctx, ruleEngineName, tag, targetRuleEngineName, request.Tag); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, targetRuleEngineName)
+	return nil
+}
+
+// RenameRuleEngine renames RuleEngine, rename onto existing RuleEngine is rejected.
+func (s *Service) RenameRuleEngine(ctx context.Context, ruleEngineName string, request *entities.RenameRequest) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) || !validator.IsAlphanumericMax30(request.Name) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+
+	if err := s.store.RenameRuleEngine(ctx, ruleEngineName, request.Name); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	s.refreshRegistry(ctx, request.Name)
+	return nil
+}
+
+// RenameTag renames tag along with its default, alias, traffic split and shadow references,
+// rename onto existing tag or alias is rejected.
+func (s *Service) RenameTag(ctx context.Context, ruleEngineName string, tag string, request *entities.RenameRequest) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(tag) || !validator.IsAlphanumericMax30(request.Name) {
+		return entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+
+	if err := s.store.RenameTag(ctx, ruleEngineName, tag, request.Name); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+// UpdateTagConfig replaces config of a disabled, non default tag.
+func (s *Service) UpdateTagConfig(ctx context.Context, ruleEngineName string, tag string, config *ruleenginecore.RuleEngineConfig) *entities.Error {
 	if !validator.IsAlphanumericMax30(ruleEngineName) {
 		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
 	}
@@ -20,24 +123,28 @@ func CreateRuleEngine(ctx context.Context, ruleEngineName string, tag string, co
 		return entities.NewErrorWithMsg(entities.ErrCodeInvalidRuleEngineConfig, err.Error())
 	}
 
-	if err := datastore.CreateRuleEngine(ctx, ruleEngineName, tag, config); err != nil {
+	if err := s.store.UpdateTagConfig(ctx, ruleEngineName, tag, config); err != nil {
 		return err
 	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
 	return nil
 }
 
-func DeleteRuleEngine(ctx context.Context, ruleEngineName string) *entities.Error {
+func (s *Service) DeleteRuleEngine(ctx context.Context, ruleEngineName string) *entities.Error {
 	if !validator.IsAlphanumericMax30(ruleEngineName) {
 		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
 	}
 
-	if err := datastore.DeleteRuleEngine(ctx, ruleEngineName); err != nil {
+	if err := s.store.DeleteRuleEngine(ctx, ruleEngineName); err != nil {
 		return err
 	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
 	return nil
 }
 
-func DeleteRuleEngineConfig(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+func (s *Service) DeleteRuleEngineConfig(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
 	if !validator.IsAlphanumericMax30(ruleEngineName) {
 		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
 	}
@@ -45,50 +152,392 @@ func DeleteRuleEngineConfig(ctx context.Context, ruleEngineName string, tag stri
 		return entities.NewError(entities.ErrCodeInvalidTagName)
 	}
 
-	if err := datastore.DeleteRuleEngineConfig(ctx, ruleEngineName, tag); err != nil {
+	if err := s.store.DeleteRuleEngineConfig(ctx, ruleEngineName, tag); err != nil {
 		return err
 	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
 	return nil
 }
 
-func GetCompleteRuleEngine(ctx context.Context, ruleEngineName string) (*entities.CompleteRuleEngine, *entities.Error) {
+func (s *Service) GetCompleteRuleEngine(ctx context.Context, ruleEngineName string) (*entities.CompleteRuleEngine, *entities.Error) {
 	if !validator.IsAlphanumericMax30(ruleEngineName) {
 		return nil, &entities.Error{ErrCode: entities.ErrCodeInvalidRuleEngineName}
 	}
 
-	if result, err := datastore.GetCompleteRuleEngine(ctx, ruleEngineName); err != nil {
+	if result, err := s.store.GetCompleteRuleEngine(ctx, ruleEngineName); err != nil {
 		return nil, err
 	} else {
 		return result, nil
 	}
 }
 
-func SetDefaultTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+// GetRuleEngineSummary fetches RuleEngine with tags, configs are omitted.
+func (s *Service) GetRuleEngineSummary(ctx context.Context, ruleEngineName string) (*entities.CompleteRuleEngine, *entities.Error) {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+
+	ruleEngine, err := s.store.GetRuleEngine(ctx, ruleEngineName)
+	if err != nil {
+		return nil, err
+	}
+	if ruleEngine == nil {
+		return nil, entities.NewError(entities.ErrCodeRuleEngineNotFound)
+	}
+
+	result := &entities.CompleteRuleEngine{
+		Name:       ruleEngine.Name,
+		DefaultTag: ruleEngine.DefaultTag,
+		Tags:       map[string]*entities.TagResponse{},
+		Aliases:    map[string]string{},
+	}
+	for alias, tag := range ruleEngine.Aliases {
+		result.Aliases[alias] = tag
+	}
+	result.TrafficSplit = ruleEngine.TrafficSplit
+	result.ShadowTag = ruleEngine.ShadowTag
+	result.DefaultTagHistory = ruleEngine.DefaultTagHistory
+	for name, tag := range ruleEngine.Tags {
+		result.Tags[name] = entities.NewTagResponse(tag, nil)
+	}
+	return result, nil
+}
+
+// GetTag fetches single tag along with its config, tag is either tag name, alias or @sha256:<hex> digest reference.
+func (s *Service) GetTag(ctx context.Context, ruleEngineName string, tag string) (*entities.TagResponse, *entities.Error) {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(tag) && !digest.IsReference(tag) {
+		return nil, entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+
+	tg, config, err := s.store.GetTagConfig(ctx, ruleEngineName, tag)
+	if err != nil {
+		return nil, err
+	}
+	return entities.NewTagResponse(tg, config), nil
+}
+
+// GetDiff computes structured difference of configs of from and to tags, from as base.
+// from and to are either tag name, alias or @sha256:<hex> digest reference.
+func (s *Service) GetDiff(ctx context.Context, ruleEngineName string, from string, to string) (*entities.ConfigDiff, *entities.Error) {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	for _, tag := range []string{from, to} {
+		if !validator.IsAlphanumericMax30(tag) && !digest.IsReference(tag) {
+			return nil, entities.NewError(entities.ErrCodeInvalidDiffQuery)
+		}
+	}
+
+	fromTag, fromConfig, err := s.store.GetTagConfig(ctx, ruleEngineName, from)
+	if err != nil {
+		return nil, err
+	}
+	toTag, toConfig, err := s.store.GetTagConfig(ctx, ruleEngineName, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result, diffErr := configdiff.Of(fromConfig, toConfig)
+	if diffErr != nil {
+		log.Logger.Error("RuleEngineConfig diff failed", zap.String("Error", diffErr.Error()))
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineConfig)
+	}
+
+	result.From, result.To = fromTag.Name, toTag.Name
+	if result.FromDigest, diffErr = digest.Of(fromConfig); diffErr == nil {
+		result.ToDigest, diffErr = digest.Of(toConfig)
+	}
+	if diffErr != nil {
+		log.Logger.Error("RuleEngineConfig digest failed", zap.String("Error", diffErr.Error()))
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineConfig)
+	}
+	result.Identical = result.FromDigest == result.ToDigest
+	return result, nil
+}
+
+func (s *Service) SetDefaultTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(tag) {
+		return entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+
+	if err := s.store.SetDefaultTag(ctx, ruleEngineName, tag); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+func (s *Service) RemoveDefaultTag(ctx context.Context, ruleEngineName string) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+
+	if err := s.store.RemoveDefaultTag(ctx, ruleEngineName); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+// RollbackDefaultTag restores previous default tag, re-enabling it if needed. consecutive rollbacks walk back the history.
+func (s *Service) RollbackDefaultTag(ctx context.Context, ruleEngineName string) (*entities.RollbackResponse, *entities.Error) {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+
+	tag, err := s.store.RollbackDefaultTag(ctx, ruleEngineName)
+	if err != nil {
+		return nil, err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return &entities.RollbackResponse{DefaultTag: tag}, nil
+}
+
+func (s *Service) EnableRuleEngine(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(tag) {
+		return entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+
+	if err := s.store.EnableTag(ctx, ruleEngineName, tag); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+func (s *Service) DisableRuleEngine(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(tag) {
+		return entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+
+	if err := s.store.DisableTag(ctx, ruleEngineName, tag); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// listCursor is position of last RuleEngine of a page, encoded as opaque cursor
+type listCursor struct {
+	SortBy         string `json:"s"`
+	Name           string `json:"n"`
+	LastUpdateTime int64  `json:"t,omitempty"`
+}
+
+// ListRuleEngines lists RuleEngine summaries, sortBy and order default to name and asc, limit defaults to 20.
+func (s *Service) ListRuleEngines(ctx context.Context, namePrefix string, sortBy string, order string, limit string, cursor string) (*entities.RuleEngineList, *entities.Error) {
+	if namePrefix != "" && !validator.IsAlphanumericMax30(namePrefix) {
+		return nil, entities.NewError(entities.ErrCodeInvalidListQuery)
+	}
+
+	query := &entities.ListRuleEnginesQuery{NamePrefix: namePrefix, SortBy: sortBy, Limit: defaultListLimit}
+	switch sortBy {
+	case "":
+		query.SortBy = entities.SortByName
+	case entities.SortByName, entities.SortByLastUpdateTime:
+	default:
+		return nil, entities.NewError(entities.ErrCodeInvalidListQuery)
+	}
+
+	switch order {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return nil, entities.NewError(entities.ErrCodeInvalidListQuery)
+	}
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxListLimit {
+			return nil, entities.NewError(entities.ErrCodeInvalidListQuery)
+		}
+		query.Limit = l
+	}
+
+	if cursor != "" {
+		position, ok := decodeListCursor(cursor)
+		if !ok || position.SortBy != query.SortBy {
+			return nil, entities.NewErrorWithMsg(entities.ErrCodeInvalidListQuery, "Invalid cursor")
+		}
+		query.HasCursor = true
+		query.AfterName = position.Name
+		query.AfterLastUpdateTime = position.LastUpdateTime
+	}
+
+	// one extra RuleEngine is fetched to know whether next page exists
+	pageSize := query.Limit
+	query.Limit++
+	ruleEngines, err := s.store.ListRuleEngines(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &entities.RuleEngineList{RuleEngines: []*entities.RuleEngineSummary{}}
+	if len(ruleEngines) > pageSize {
+		ruleEngines = ruleEngines[:pageSize]
+		last := ruleEngines[pageSize-1]
+		result.NextCursor = encodeListCursor(&listCursor{SortBy: query.SortBy, Name: last.Name, LastUpdateTime: last.LastUpdateTime})
+	}
+
+	for _, ruleEngine := range ruleEngines {
+		enabledTags := []string{}
+		for name, tag := range ruleEngine.Tags {
+			if tag.IsEnable {
+				enabledTags = append(enabledTags, name)
+			}
+		}
+		sort.Strings(enabledTags)
+
+		result.RuleEngines = append(result.RuleEngines, &entities.RuleEngineSummary{
+			Name:           ruleEngine.Name,
+			DefaultTag:     ruleEngine.DefaultTag,
+			TagCount:       len(ruleEngine.Tags),
+			EnabledTags:    enabledTags,
+			LastUpdateTime: ruleEngine.LastUpdateTime,
+		})
+	}
+	return result, nil
+}
+
+func encodeListCursor(position *listCursor) string {
+	data, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(cursor string) (*listCursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+	var position listCursor
+	if err := json.Unmarshal(data, &position); err != nil {
+		return nil, false
+	}
+	return &position, true
+}
+
+// SetAlias points alias to enabled tag, existing alias is re-pointed.
+func (s *Service) SetAlias(ctx context.Context, ruleEngineName string, alias string, tag string) *entities.Error {
 	if !validator.IsAlphanumericMax30(ruleEngineName) {
 		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
 	}
+	if !validator.IsAlphanumericMax30(alias) {
+		return entities.NewError(entities.ErrCodeInvalidAliasName)
+	}
 	if !validator.IsAlphanumericMax30(tag) {
 		return entities.NewError(entities.ErrCodeInvalidTagName)
 	}
 
-	if err := datastore.SetDefaultTag(ctx, ruleEngineName, tag); err != nil {
+	if err := s.store.SetAlias(ctx, ruleEngineName, alias, tag); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+func (s *Service) GetAlias(ctx context.Context, ruleEngineName string, alias string) (*entities.AliasResponse, *entities.Error) {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(alias) {
+		return nil, entities.NewError(entities.ErrCodeInvalidAliasName)
+	}
+
+	ruleEngine, err := s.store.GetRuleEngine(ctx, ruleEngineName)
+	if err != nil {
+		return nil, err
+	}
+	if ruleEngine == nil {
+		return nil, entities.NewError(entities.ErrCodeRuleEngineNotFound)
+	}
+
+	tag, ok := ruleEngine.Aliases[alias]
+	if !ok {
+		return nil, entities.NewError(entities.ErrCodeAliasNotFound)
+	}
+	return &entities.AliasResponse{Name: alias, Tag: tag}, nil
+}
+
+func (s *Service) DeleteAlias(ctx context.Context, ruleEngineName string, alias string) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(alias) {
+		return entities.NewError(entities.ErrCodeInvalidAliasName)
+	}
+
+	if err := s.store.DeleteAlias(ctx, ruleEngineName, alias); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+// SetTrafficSplit routes evaluations without tag across enabled tags as per weights, weights must sum up to 100.
+func (s *Service) SetTrafficSplit(ctx context.Context, ruleEngineName string, split []*entities.TagWeight) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if len(split) == 0 {
+		return entities.NewErrorWithMsg(entities.ErrCodeInvalidTrafficSplit, "at least one tag is required")
+	}
+	for _, tw := range split {
+		if tw == nil || !validator.IsAlphanumericMax30(tw.Tag) {
+			return entities.NewError(entities.ErrCodeInvalidTagName)
+		}
+	}
+
+	if err := s.store.SetTrafficSplit(ctx, ruleEngineName, split); err != nil {
 		return err
 	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
 	return nil
 }
 
-func RemoveDefaultTag(ctx context.Context, ruleEngineName string) *entities.Error {
+// RemoveTrafficSplit routes evaluations without tag back to defaultTag.
+func (s *Service) RemoveTrafficSplit(ctx context.Context, ruleEngineName string) *entities.Error {
 	if !validator.IsAlphanumericMax30(ruleEngineName) {
 		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
 	}
 
-	if err := datastore.RemoveDefaultTag(ctx, ruleEngineName); err != nil {
+	if err := s.store.SetTrafficSplit(ctx, ruleEngineName, nil); err != nil {
 		return err
 	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
 	return nil
 }
 
-func EnableRuleEngine(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+// SetTagSchedule schedules tag activation(enable and set as default) and/or expiry(revert default and disable) as unix time.
+// schedule is applied by scheduler, hence precision is of scheduler interval.
+func (s *Service) SetTagSchedule(ctx context.Context, ruleEngineName string, tag string, request *entities.ScheduleRequest) *entities.Error {
 	if !validator.IsAlphanumericMax30(ruleEngineName) {
 		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
 	}
@@ -96,13 +545,25 @@ func EnableRuleEngine(ctx context.Context, ruleEngineName string, tag string) *e
 		return entities.NewError(entities.ErrCodeInvalidTagName)
 	}
 
-	if err := datastore.EnableTag(ctx, ruleEngineName, tag); err != nil {
+	if request.ActivateAt < 0 || request.ExpireAt < 0 || (request.ActivateAt == 0 && request.ExpireAt == 0) {
+		return entities.NewError(entities.ErrCodeInvalidSchedule)
+	}
+	if request.ExpireAt != 0 {
+		if request.ExpireAt <= time.Now().Unix() || (request.ActivateAt != 0 && request.ExpireAt <= request.ActivateAt) {
+			return entities.NewError(entities.ErrCodeInvalidSchedule)
+		}
+	}
+
+	if err := s.store.SetTagSchedule(ctx, ruleEngineName, tag, request.ActivateAt, request.ExpireAt); err != nil {
 		return err
 	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
 	return nil
 }
 
-func DisableRuleEngine(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+// RemoveTagSchedule cancels pending activation and expiry of tag, already applied ones are not reverted.
+func (s *Service) RemoveTagSchedule(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
 	if !validator.IsAlphanumericMax30(ruleEngineName) {
 		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
 	}
@@ -110,8 +571,117 @@ func DisableRuleEngine(ctx context.Context, ruleEngineName string, tag string) *
 		return entities.NewError(entities.ErrCodeInvalidTagName)
 	}
 
-	if err := datastore.DisableTag(ctx, ruleEngineName, tag); err != nil {
+	if err := s.store.SetTagSchedule(ctx, ruleEngineName, tag, 0, 0); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+// SetShadowTag sets enabled tag to be evaluated asynchronously alongside evaluations without tag.
+func (s *Service) SetShadowTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if !validator.IsAlphanumericMax30(tag) {
+		return entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+
+	if err := s.store.SetShadowTag(ctx, ruleEngineName, tag); err != nil {
+		return err
+	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
+	return nil
+}
+
+func (s *Service) RemoveShadowTag(ctx context.Context, ruleEngineName string) *entities.Error {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+
+	if err := s.store.SetShadowTag(ctx, ruleEngineName, ""); err != nil {
 		return err
 	}
+
+	s.refreshRegistry(ctx, ruleEngineName)
 	return nil
 }
+
+// ListShadowDisagreements lists shadow disagreements newest first, limit defaults to 20.
+func (s *Service) ListShadowDisagreements(ctx context.Context, ruleEngineName string, limit string, cursor string) (*entities.ShadowDisagreementList, *entities.Error) {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+
+	pageSize, before, err := pageQuery(limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	disagreements, err := s.store.ListShadowDisagreements(ctx, ruleEngineName, before, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &entities.ShadowDisagreementList{Disagreements: disagreements}
+	if len(disagreements) > pageSize {
+		result.Disagreements = disagreements[:pageSize]
+		result.NextCursor = disagreements[pageSize-1].ID.Hex()
+	}
+	return result, nil
+}
+
+// GetHistory lists audit events of RuleEngine newest first, limit defaults to 20. history of deleted RuleEngine is retained.
+func (s *Service) GetHistory(ctx context.Context, ruleEngineName string, limit string, cursor string) (*entities.AuditEventList, *entities.Error) {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+
+	pageSize, before, err := pageQuery(limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.store.ListAuditEvents(ctx, ruleEngineName, before, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &entities.AuditEventList{Events: events}
+	if len(events) > pageSize {
+		result.Events = events[:pageSize]
+		result.NextCursor = events[pageSize-1].ID.Hex()
+	}
+	return result, nil
+}
+
+// pageQuery parses limit and cursor of newest first pages, cursor is id of last item of previous page
+func pageQuery(limit string, cursor string) (int, primitive.ObjectID, *entities.Error) {
+	pageSize := defaultListLimit
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxListLimit {
+			return 0, primitive.NilObjectID, entities.NewError(entities.ErrCodeInvalidPageQuery)
+		}
+		pageSize = l
+	}
+
+	before := primitive.NilObjectID
+	if cursor != "" {
+		id, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return 0, primitive.NilObjectID, entities.NewError(entities.ErrCodeInvalidPageQuery)
+		}
+		before = id
+	}
+	return pageSize, before, nil
+}
+
+// syncs local RuleEngine instances after successful datastore update, failure is only logged as datastore is source of truth.
+func (s *Service) refreshRegistry(ctx context.Context, ruleEngineName string) {
+	if err := s.ruleEngines.Refresh(ctx, ruleEngineName); err != nil {
+		log.Logger.Error("RuleEngine registry refresh failed", zap.String("RuleEngine", ruleEngineName), zap.String("Error", err.Error()))
+	}
+}
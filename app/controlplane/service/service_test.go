@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.uber.org/zap"
+)
+
+// tierConfig rewards gold tier with given points, rule of undefined conditionType makes it invalid
+func tierConfig(points int, conditionType string) *ruleenginecore.RuleEngineConfig {
+	return &ruleenginecore.RuleEngineConfig{
+		Fields: ruleenginecore.Fields{"tier": "string"},
+		ConditionTypes: map[string]*ruleenginecore.ConditionType{
+			"gold": {Operator: "==", OperandType: "string", Operands: []*ruleenginecore.Operand{
+				{OperandAs: "field", Val: "tier"},
+				{OperandAs: "constant", Val: "gold"},
+			}},
+		},
+		Rules: map[string]*ruleenginecore.Rule{
+			"reward": {Priority: 1, RootCondition: &ruleenginecore.Condition{ConditionType: conditionType}, Result: map[string]any{"points": points}},
+		},
+	}
+}
+
+// newTestService is Service over memory datastore, along with registry it keeps in sync
+func newTestService(t *testing.T) (*Service, *registry.Registry) {
+	t.Helper()
+	log.Logger = zap.NewNop()
+	config.Datastore = &config.DatastoreConf{Memory: &config.MemoryConf{}}
+	store, err := datastore.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleEngines := registry.New(store)
+	return New(store, ruleEngines), ruleEngines
+}
+
+func errCodeOf(err *entities.Error) uint {
+	if err == nil {
+		return 0
+	}
+	return err.ErrCode
+}
+
+// serviceStep is a service call along with errCode it is expected to fail with, 0 as success
+type serviceStep struct {
+	name    string
+	run     func() *entities.Error
+	wantErr uint
+}
+
+func runServiceSteps(t *testing.T, steps []serviceStep) {
+	t.Helper()
+	for _, step := range steps {
+		if err := step.run(); errCodeOf(err) != step.wantErr {
+			t.Fatalf("%v = %v, want errCode %v", step.name, err, step.wantErr)
+		}
+	}
+}
+
+func TestCreateRuleEngine(t *testing.T) {
+	tests := []struct {
+		name       string
+		ruleEngine string
+		tag        string
+		config     *ruleenginecore.RuleEngineConfig
+		wantErr    uint
+	}{
+		{"valid", "shop", "v1", tierConfig(10, "gold"), 0},
+		{"invalid RuleEngine name", "shop-1", "v1", tierConfig(10, "gold"), entities.ErrCodeInvalidRuleEngineName},
+		{"invalid tag name", "shop", "v-1", tierConfig(10, "gold"), entities.ErrCodeInvalidTagName},
+		{"invalid config", "shop", "v1", tierConfig(10, "silver"), entities.ErrCodeInvalidRuleEngineConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, ruleEngines := newTestService(t)
+			if err := svc.CreateRuleEngine(context.Background(), tt.ruleEngine, tt.tag, tt.config); errCodeOf(err) != tt.wantErr {
+				t.Fatalf("CreateRuleEngine() = %v, want errCode %v", err, tt.wantErr)
+			}
+
+			// registry holds created RuleEngine, i.e. default is reported as not set instead of RuleEngine not found
+			wantGetErr := uint(entities.ErrCodeDefaultTagNotSet)
+			if tt.wantErr != 0 {
+				wantGetErr = entities.ErrCodeRuleEngineNotFound
+			}
+			if _, _, err := ruleEngines.Get(tt.ruleEngine, "", ""); errCodeOf(err) != wantGetErr {
+				t.Errorf("registry Get() = %v, want errCode %v", err, wantGetErr)
+			}
+		})
+	}
+}
+
+// every successful write is visible in registry right away, without waiting for worker
+func TestTagLifecycleRefreshesRegistry(t *testing.T) {
+	svc, ruleEngines := newTestService(t)
+	ctx := context.Background()
+
+	runServiceSteps(t, []serviceStep{
+		{"create", func() *entities.Error { return svc.CreateRuleEngine(ctx, "shop", "v1", tierConfig(10, "gold")) }, 0},
+		{"create v2", func() *entities.Error { return svc.CreateRuleEngine(ctx, "shop", "v2", tierConfig(10, "gold")) }, 0},
+		{"create v3", func() *entities.Error { return svc.CreateRuleEngine(ctx, "shop", "v3", tierConfig(10, "gold")) }, 0},
+		{"update config of disabled tag", func() *entities.Error { return svc.UpdateTagConfig(ctx, "shop", "v2", tierConfig(20, "gold")) }, 0},
+		{"update to invalid config", func() *entities.Error { return svc.UpdateTagConfig(ctx, "shop", "v2", tierConfig(20, "silver")) }, entities.ErrCodeInvalidRuleEngineConfig},
+		{"enable", func() *entities.Error { return svc.EnableRuleEngine(ctx, "shop", "v1") }, 0},
+		{"enable v2", func() *entities.Error { return svc.EnableRuleEngine(ctx, "shop", "v2") }, 0},
+		{"update config of enabled tag", func() *entities.Error { return svc.UpdateTagConfig(ctx, "shop", "v2", tierConfig(30, "gold")) }, entities.ErrCodeTagUpdateNotAllowed},
+		{"set default", func() *entities.Error { return svc.SetDefaultTag(ctx, "shop", "v1") }, 0},
+	})
+
+	input := ruleenginecore.Input{"tier": "gold"}
+	tests := []struct {
+		name       string
+		tag        string
+		wantTag    string
+		wantPoints any
+	}{
+		{"default", "", "v1", 10},
+		{"updated config", "v2", "v2", 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, engine, err := ruleEngines.Get("shop", tt.tag, "")
+			if err != nil || tag != tt.wantTag {
+				t.Fatalf("registry Get() = %v, %v, want %v", tag, err, tt.wantTag)
+			}
+			results, evalErr := engine.Evaluate(ctx, input, ruleenginecore.EvaluateOptions().Complete())
+			if evalErr != nil || len(results) != 1 || results[0].Result["points"] != tt.wantPoints {
+				t.Errorf("Evaluate() = %v, %v, want %v points", results, evalErr, tt.wantPoints)
+			}
+		})
+	}
+
+	runServiceSteps(t, []serviceStep{
+		{"set default v2", func() *entities.Error { return svc.SetDefaultTag(ctx, "shop", "v2") }, 0},
+		{"disable", func() *entities.Error { return svc.DisableRuleEngine(ctx, "shop", "v1") }, 0},
+	})
+	if _, _, err := ruleEngines.Get("shop", "v1", ""); errCodeOf(err) != entities.ErrCodeTagNotEnabled {
+		t.Errorf("registry Get() of disabled tag = %v", err)
+	}
+
+	if err := svc.DeleteRuleEngineConfig(ctx, "shop", "v3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ruleEngines.Get("shop", "v3", ""); errCodeOf(err) != entities.ErrCodeTagNotFound {
+		t.Errorf("registry Get() of deleted tag = %v", err)
+	}
+
+	if err := svc.DeleteRuleEngine(ctx, "shop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ruleEngines.Get("shop", "", ""); errCodeOf(err) != entities.ErrCodeRuleEngineNotFound {
+		t.Errorf("registry Get() after delete = %v", err)
+	}
+}
+
+func TestSetTagSchedule(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		name    string
+		tag     string
+		request *entities.ScheduleRequest
+		wantErr uint
+	}{
+		{"activation", "v1", &entities.ScheduleRequest{ActivateAt: now + 100}, 0},
+		{"activation and expiry", "v1", &entities.ScheduleRequest{ActivateAt: now + 100, ExpireAt: now + 200}, 0},
+		{"unknown tag", "v9", &entities.ScheduleRequest{ActivateAt: now + 100}, entities.ErrCodeTagNotFound},
+		{"nothing scheduled", "v1", &entities.ScheduleRequest{}, entities.ErrCodeInvalidSchedule},
+		{"negative time", "v1", &entities.ScheduleRequest{ActivateAt: -1}, entities.ErrCodeInvalidSchedule},
+		{"expiry in past", "v1", &entities.ScheduleRequest{ExpireAt: now - 100}, entities.ErrCodeInvalidSchedule},
+		{"expiry before activation", "v1", &entities.ScheduleRequest{ActivateAt: now + 200, ExpireAt: now + 100}, entities.ErrCodeInvalidSchedule},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newTestService(t)
+			ctx := context.Background()
+			if err := svc.CreateRuleEngine(ctx, "shop", "v1", tierConfig(10, "gold")); err != nil {
+				t.Fatal(err)
+			}
+			if err := svc.SetTagSchedule(ctx, "shop", tt.tag, tt.request); errCodeOf(err) != tt.wantErr {
+				t.Fatalf("SetTagSchedule() = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr == 0 {
+				if err := svc.RemoveTagSchedule(ctx, "shop", tt.tag); err != nil {
+					t.Errorf("RemoveTagSchedule() = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestListRuleEngines(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	for _, name := range []string{"cart", "shop1", "shop2", "shop3"} {
+		if err := svc.CreateRuleEngine(ctx, name, "v1", tierConfig(10, "gold")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		prefix  string
+		sortBy  string
+		order   string
+		limit   string
+		want    []string
+		wantErr uint
+	}{
+		{name: "every RuleEngine", want: []string{"cart", "shop1", "shop2", "shop3"}},
+		{name: "prefix", prefix: "shop", want: []string{"shop1", "shop2", "shop3"}},
+		{name: "descending", prefix: "shop", order: "desc", want: []string{"shop3", "shop2", "shop1"}},
+		{name: "invalid prefix", prefix: "shop-", wantErr: entities.ErrCodeInvalidListQuery},
+		{name: "invalid sort", sortBy: "tags", wantErr: entities.ErrCodeInvalidListQuery},
+		{name: "invalid order", order: "up", wantErr: entities.ErrCodeInvalidListQuery},
+		{name: "invalid limit", limit: "0", wantErr: entities.ErrCodeInvalidListQuery},
+		{name: "limit above max", limit: fmt.Sprint(maxListLimit + 1), wantErr: entities.ErrCodeInvalidListQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := svc.ListRuleEngines(ctx, tt.prefix, tt.sortBy, tt.order, tt.limit, "")
+			if errCodeOf(err) != tt.wantErr {
+				t.Fatalf("ListRuleEngines() error = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr != 0 {
+				return
+			}
+			names := []string{}
+			for _, summary := range list.RuleEngines {
+				names = append(names, summary.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) || list.NextCursor != "" {
+				t.Errorf("ListRuleEngines() = %v, cursor %q, want %v", names, list.NextCursor, tt.want)
+			}
+		})
+	}
+
+	// pages follow cursor till last page
+	names := []string{}
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		list, err := svc.ListRuleEngines(ctx, "", "", "", "3", cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, summary := range list.RuleEngines {
+			names = append(names, summary.Name)
+		}
+		if cursor = list.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"cart", "shop1", "shop2", "shop3"}) {
+		t.Errorf("paged names = %v", names)
+	}
+
+	if _, err := svc.ListRuleEngines(ctx, "", entities.SortByLastUpdateTime, "", "", encodeListCursor(&listCursor{SortBy: entities.SortByName, Name: "cart"})); errCodeOf(err) != entities.ErrCodeInvalidListQuery {
+		t.Errorf("ListRuleEngines() with cursor of other sort = %v", err)
+	}
+}
+
+func TestPageQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    string
+		cursor   string
+		wantSize int
+		wantErr  uint
+	}{
+		{"defaults", "", "", defaultListLimit, 0},
+		{"limit", "5", "", 5, 0},
+		{"cursor", "", "64b7f0a2c1d2e3f405060708", defaultListLimit, 0},
+		{"invalid limit", "x", "", 0, entities.ErrCodeInvalidPageQuery},
+		{"limit above max", fmt.Sprint(maxListLimit + 1), "", 0, entities.ErrCodeInvalidPageQuery},
+		{"invalid cursor", "", "cursor", 0, entities.ErrCodeInvalidPageQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, before, err := pageQuery(tt.limit, tt.cursor)
+			if size != tt.wantSize || errCodeOf(err) != tt.wantErr {
+				t.Fatalf("pageQuery() = %v, %v, want %v, errCode %v", size, err, tt.wantSize, tt.wantErr)
+			}
+			if tt.wantErr == 0 && tt.cursor != "" && before.Hex() != tt.cursor {
+				t.Errorf("before = %v, want %v", before.Hex(), tt.cursor)
+			}
+		})
+	}
+}
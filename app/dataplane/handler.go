@@ -0,0 +1,64 @@
+package dataplane
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/niharrathod/ruleengine/app/dataplane/service"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.uber.org/zap/zapcore"
+)
+
+func Evaluate(svc *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ruleEngineName := ctx.Param("ruleengine")
+		// tag is optional, empty for default tag evaluation
+		tag := ctx.Param("tag")
+		var request entities.EvaluateRequest
+		if err := ctx.BindJSON(&request); err != nil {
+			log.Logger.Error("Could not unmarshal the evaluate request as body", zapcore.Field{Key: "Error", String: err.Error()})
+			setResponse(ctx, entities.NewError(entities.ErrCodeParsingFailed))
+			return
+		}
+
+		response, err := svc.Evaluate(ctx, ruleEngineName, tag, &request)
+		if err != nil {
+			setResponse(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+// ShadowMetrics serves shadow metrics in expvar format
+func ShadowMetrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Content-Type", "application/json; charset=utf-8")
+		service.WriteShadowMetrics(ctx.Writer)
+	}
+}
+
+func setResponse(ctx *gin.Context, err *entities.Error) {
+	switch err.ErrCode {
+	case entities.ErrCodeRuleEngineNotFound,
+		entities.ErrCodeTagNotFound,
+		entities.ErrCodeDefaultTagNotSet:
+		ctx.JSON(http.StatusNotFound, err)
+		return
+	case entities.ErrCodeParsingFailed,
+		entities.ErrCodeInvalidRuleEngineName,
+		entities.ErrCodeInvalidTagName,
+		entities.ErrCodeTagNotEnabled,
+		entities.ErrCodeInvalidEvaluateOption,
+		entities.ErrCodeEvaluationFailed:
+		ctx.JSON(http.StatusBadRequest, err)
+		return
+	case entities.ErrCodeDatastoreFailed,
+		entities.ErrCodeInvalidRuleEngineConfig:
+		ctx.JSON(http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusInternalServerError, err)
+}
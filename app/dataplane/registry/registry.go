@@ -0,0 +1,247 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+type instance struct {
+	engineConfigID primitive.ObjectID
+	digest         string
+	engine         ruleenginecore.RuleEngine
+}
+
+type ruleEngineInstances struct {
+	defaultTag string
+
+	// incarnation and version of synced RuleEngine
+	incarnation primitive.ObjectID
+	version     int64
+
+	// map of tag and instance, only enabled tags
+	tags map[string]*instance
+
+	// tags without instance, so that evaluation of disabled tag is reported as such
+	disabledTags map[string]bool
+
+	// map of alias and tag
+	aliases map[string]string
+
+	trafficSplit []*entities.TagWeight
+	shadowTag    string
+}
+
+// Registry of RuleEngine instances keyed by (ruleEngineName, tag), safe for concurrent use.
+type Registry struct {
+	store       datastore.Store
+	mutex       sync.RWMutex
+	ruleEngines map[string]*ruleEngineInstances
+}
+
+func New(store datastore.Store) *Registry {
+	return &Registry{store: store, ruleEngines: map[string]*ruleEngineInstances{}}
+}
+
+// Get returns RuleEngine instance for given tag along with resolved tag, in case of empty tag traffic split tag selected
+// by key is considered if split is set, otherwise defaultTag.
+// tag is either tag name, alias or @sha256:<hex> digest reference, digest shared by multiple tags resolves to smallest tag name.
+// Miss is reported as RuleEngine or tag not found, tag not enabled or default not set as per synced state.
+func (r *Registry) Get(ruleEngineName string, tag string, key string) (string, ruleenginecore.RuleEngine, *entities.Error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	instances, ok := r.ruleEngines[ruleEngineName]
+	if !ok {
+		return "", nil, entities.NewError(entities.ErrCodeRuleEngineNotFound)
+	}
+
+	if tag == "" {
+		if tag = SelectTag(instances.trafficSplit, ruleEngineName, key); tag == "" {
+			tag = instances.defaultTag
+		}
+		if tag == "" {
+			return "", nil, entities.NewError(entities.ErrCodeDefaultTagNotSet)
+		}
+	}
+	if aliased, ok := instances.aliases[tag]; ok {
+		tag = aliased
+	}
+
+	if digest.IsReference(tag) {
+		d := digest.FromReference(tag)
+		resolved := ""
+		for name, i := range instances.tags {
+			if i.digest == d && (resolved == "" || name < resolved) {
+				resolved = name
+			}
+		}
+		if resolved == "" {
+			return "", nil, entities.NewError(entities.ErrCodeTagNotFound)
+		}
+		tag = resolved
+	}
+
+	if i, ok := instances.tags[tag]; ok {
+		return tag, i.engine, nil
+	}
+	if instances.disabledTags[tag] {
+		return "", nil, entities.NewError(entities.ErrCodeTagNotEnabled)
+	}
+	return "", nil, entities.NewError(entities.ErrCodeTagNotFound)
+}
+
+// Shadow returns RuleEngine instance of shadow tag along with shadow tag, not found in case shadow tag is not set
+func (r *Registry) Shadow(ruleEngineName string) (string, ruleenginecore.RuleEngine, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	instances, ok := r.ruleEngines[ruleEngineName]
+	if !ok || instances.shadowTag == "" {
+		return "", nil, false
+	}
+
+	if i, ok := instances.tags[instances.shadowTag]; ok {
+		return instances.shadowTag, i.engine, true
+	}
+	return "", nil, false
+}
+
+// Names returns names of every RuleEngine having instances
+func (r *Registry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.ruleEngines))
+	for name := range r.ruleEngines {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Remove discards all instances of RuleEngine
+func (r *Registry) Remove(ruleEngineName string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.ruleEngines, ruleEngineName)
+}
+
+// Sync aligns instances of RuleEngine with given persisted state, i.e. creates instance for newly enabled tag,
+// discards instance of disabled or deleted tag and updates defaultTag. nil ruleEngine discards all instances.
+// Stale state, i.e. of older incarnation or of lower version within same incarnation than already synced state, is ignored.
+// RuleEngine deleted and recreated, or renamed onto a former name, is a newer incarnation hence synced irrespective of version.
+func (r *Registry) Sync(ctx context.Context, ruleEngineName string, ruleEngine *entities.RuleEngine) *entities.Error {
+	if ruleEngine == nil {
+		r.Remove(ruleEngineName)
+		return nil
+	}
+
+	// build instances for newly enabled tags outside of lock
+	r.mutex.RLock()
+	existing := r.ruleEngines[ruleEngineName]
+	if existing != nil && existing.isNewerThan(ruleEngine) {
+		r.mutex.RUnlock()
+		return nil
+	}
+	built := map[string]*instance{}
+	for tag, t := range ruleEngine.Tags {
+		if !t.IsEnable {
+			continue
+		}
+		if existing != nil {
+			if i, ok := existing.tags[tag]; ok && i.engineConfigID == t.EngineConfigID {
+				continue
+			}
+		}
+		built[tag] = nil
+	}
+	r.mutex.RUnlock()
+
+	for tag := range built {
+		i, err := r.newInstance(ctx, ruleEngine.Tags[tag])
+		if err != nil {
+			log.Logger.Error("RuleEngine instance creation failed", zap.String("RuleEngine", ruleEngineName), zap.String("Tag", tag), zap.String("Error", err.Error()))
+			return err
+		}
+		built[tag] = i
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// checked again, newer state might be synced meanwhile
+	existing = r.ruleEngines[ruleEngineName]
+	if existing != nil && existing.isNewerThan(ruleEngine) {
+		return nil
+	}
+
+	synced := &ruleEngineInstances{
+		defaultTag:   ruleEngine.DefaultTag,
+		incarnation:  ruleEngine.Incarnation,
+		version:      ruleEngine.Version,
+		tags:         map[string]*instance{},
+		disabledTags: map[string]bool{},
+		aliases:      map[string]string{},
+		trafficSplit: ruleEngine.TrafficSplit,
+		shadowTag:    ruleEngine.ShadowTag,
+	}
+	for alias, tag := range ruleEngine.Aliases {
+		synced.aliases[alias] = tag
+	}
+	for tag, t := range ruleEngine.Tags {
+		if !t.IsEnable {
+			synced.disabledTags[tag] = true
+			continue
+		}
+		if i, ok := built[tag]; ok {
+			synced.tags[tag] = i
+		} else if existing != nil {
+			if i, ok := existing.tags[tag]; ok && i.engineConfigID == t.EngineConfigID {
+				synced.tags[tag] = i
+			}
+		}
+	}
+
+	r.ruleEngines[ruleEngineName] = synced
+	return nil
+}
+
+// isNewerThan reports whether synced state is newer than persisted state of ruleEngine
+func (instances *ruleEngineInstances) isNewerThan(ruleEngine *entities.RuleEngine) bool {
+	if instances.incarnation != ruleEngine.Incarnation {
+		return bytes.Compare(instances.incarnation[:], ruleEngine.Incarnation[:]) > 0
+	}
+	return instances.version > ruleEngine.Version
+}
+
+// Refresh syncs instances of RuleEngine from datastore
+func (r *Registry) Refresh(ctx context.Context, ruleEngineName string) *entities.Error {
+	ruleEngine, err := r.store.GetRuleEngine(ctx, ruleEngineName)
+	if err != nil {
+		return err
+	}
+	return r.Sync(ctx, ruleEngineName, ruleEngine)
+}
+
+func (r *Registry) newInstance(ctx context.Context, tag *entities.Tag) (*instance, *entities.Error) {
+	config, err := r.store.GetRuleEngineConfig(ctx, tag.EngineConfigID)
+	if err != nil {
+		return nil, err
+	}
+
+	engine, coreErr := ruleenginecore.New(config)
+	if coreErr != nil {
+		return nil, entities.NewErrorWithMsg(entities.ErrCodeInvalidRuleEngineConfig, coreErr.Error())
+	}
+
+	return &instance{engineConfigID: tag.EngineConfigID, digest: tag.Digest, engine: engine}, nil
+}
@@ -0,0 +1,234 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.uber.org/zap"
+)
+
+// adultConfig matches age of at least minAge
+func adultConfig(minAge string) *ruleenginecore.RuleEngineConfig {
+	return &ruleenginecore.RuleEngineConfig{
+		Fields: ruleenginecore.Fields{"age": "int"},
+		ConditionTypes: map[string]*ruleenginecore.ConditionType{
+			"adult": {Operator: ">=", OperandType: "int", Operands: []*ruleenginecore.Operand{
+				{OperandAs: "field", Val: "age"},
+				{OperandAs: "constant", Val: minAge},
+			}},
+		},
+		Rules: map[string]*ruleenginecore.Rule{
+			"adult": {Priority: 1, RootCondition: &ruleenginecore.Condition{ConditionType: "adult"}, Result: map[string]any{"adult": true}},
+		},
+	}
+}
+
+// shopRegistry holds RuleEngine "shop" with default v1, enabled v2 aliased as stable and disabled v3,
+// v1 and v2 share config
+func shopRegistry(t *testing.T) (*Registry, datastore.Store) {
+	t.Helper()
+	log.Logger = zap.NewNop()
+	config.Datastore = &config.DatastoreConf{Memory: &config.MemoryConf{}}
+	store, err := datastore.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	steps := []func() *entities.Error{
+		func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", adultConfig("18")) },
+		func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v2", adultConfig("18")) },
+		func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v3", adultConfig("21")) },
+		func() *entities.Error { return store.EnableTag(ctx, "shop", "v1") },
+		func() *entities.Error { return store.EnableTag(ctx, "shop", "v2") },
+		func() *entities.Error { return store.SetDefaultTag(ctx, "shop", "v1") },
+		func() *entities.Error { return store.SetAlias(ctx, "shop", "stable", "v2") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry := New(store)
+	if err := registry.Refresh(ctx, "shop"); err != nil {
+		t.Fatal(err)
+	}
+	return registry, store
+}
+
+func TestRegistryGet(t *testing.T) {
+	registry, store := shopRegistry(t)
+	ruleEngine, err := store.GetRuleEngine(context.Background(), "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		ruleEngine string
+		tag        string
+		wantTag    string
+		wantErr    uint
+	}{
+		{"default", "shop", "", "v1", 0},
+		{"tag", "shop", "v2", "v2", 0},
+		{"alias", "shop", "stable", "v2", 0},
+		{"shared digest resolves to smallest tag", "shop", "@" + ruleEngine.Tags["v2"].Digest, "v1", 0},
+		{"digest of disabled tag", "shop", "@" + ruleEngine.Tags["v3"].Digest, "", entities.ErrCodeTagNotFound},
+		{"disabled tag", "shop", "v3", "", entities.ErrCodeTagNotEnabled},
+		{"unknown tag", "shop", "v9", "", entities.ErrCodeTagNotFound},
+		{"unknown RuleEngine", "cart", "", "", entities.ErrCodeRuleEngineNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, engine, err := registry.Get(tt.ruleEngine, tt.tag, "")
+			if tt.wantErr != 0 {
+				if err == nil || err.ErrCode != tt.wantErr {
+					t.Fatalf("Get() error = %v, want errCode %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || tag != tt.wantTag || engine == nil {
+				t.Errorf("Get() = %v, %v, %v, want %v", tag, engine, err, tt.wantTag)
+			}
+		})
+	}
+}
+
+func TestRegistrySync(t *testing.T) {
+	registry, store := shopRegistry(t)
+	ctx := context.Background()
+
+	stale, err := store.GetRuleEngine(ctx, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// traffic split takes precedence over default
+	if err := store.SetTrafficSplit(ctx, "shop", []*entities.TagWeight{{Tag: "v2", Weight: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Refresh(ctx, "shop"); err != nil {
+		t.Fatal(err)
+	}
+	if tag, _, err := registry.Get("shop", "", "key"); err != nil || tag != "v2" {
+		t.Errorf("Get() by split = %v, %v, want v2", tag, err)
+	}
+
+	// state of lower version is ignored
+	if err := registry.Sync(ctx, "shop", stale); err != nil {
+		t.Fatal(err)
+	}
+	if tag, _, _ := registry.Get("shop", "", "key"); tag != "v2" {
+		t.Errorf("stale sync applied, Get() = %v", tag)
+	}
+
+	// nil RuleEngine removes instances
+	if err := registry.Sync(ctx, "shop", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := registry.Get("shop", "", ""); err == nil || err.ErrCode != entities.ErrCodeRuleEngineNotFound {
+		t.Errorf("Get() after removal error = %v", err)
+	}
+	if names := registry.Names(); len(names) != 0 {
+		t.Errorf("Names() = %v, want none", names)
+	}
+}
+
+// replica which missed deletion still syncs RuleEngine recreated on same name, even though its version starts over
+func TestRegistrySyncRecreated(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		recreate func(store datastore.Store) *entities.Error
+	}{
+		{"deleted and created", func(store datastore.Store) *entities.Error {
+			if err := store.DeleteRuleEngine(ctx, "shop"); err != nil {
+				return err
+			}
+			return store.CreateRuleEngine(ctx, "shop", "v1", adultConfig("21"))
+		}},
+		{"renamed onto former name", func(store datastore.Store) *entities.Error {
+			if err := store.DeleteRuleEngine(ctx, "shop"); err != nil {
+				return err
+			}
+			if err := store.CreateRuleEngine(ctx, "cart", "v1", adultConfig("21")); err != nil {
+				return err
+			}
+			return store.RenameRuleEngine(ctx, "cart", "shop")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, store := shopRegistry(t)
+			deleted, _ := store.GetRuleEngine(ctx, "shop")
+
+			if err := tt.recreate(store); err != nil {
+				t.Fatal(err)
+			}
+			recreated, err := store.GetRuleEngine(ctx, "shop")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if recreated.Version >= deleted.Version {
+				t.Fatalf("recreated version %v, want below %v", recreated.Version, deleted.Version)
+			}
+
+			if err := registry.Sync(ctx, "shop", recreated); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := registry.Get("shop", "v1", ""); err == nil || err.ErrCode != entities.ErrCodeTagNotEnabled {
+				t.Errorf("Get() of recreated disabled v1 error = %v, want errCode %v", err, entities.ErrCodeTagNotEnabled)
+			}
+
+			// former incarnation is stale, whatever its version
+			if err := registry.Sync(ctx, "shop", deleted); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := registry.Get("shop", "", ""); err == nil || err.ErrCode != entities.ErrCodeDefaultTagNotSet {
+				t.Errorf("Get() after stale sync error = %v, want errCode %v", err, entities.ErrCodeDefaultTagNotSet)
+			}
+		})
+	}
+}
+
+func TestSelectTag(t *testing.T) {
+	tests := []struct {
+		name  string
+		split []*entities.TagWeight
+		key   string
+		want  string
+	}{
+		{"no split", nil, "key", ""},
+		{"single tag", []*entities.TagWeight{{Tag: "v1", Weight: 100}}, "key", "v1"},
+		{"random without key", []*entities.TagWeight{{Tag: "v1", Weight: 100}}, "", "v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SelectTag(tt.split, "shop", tt.key); got != tt.want {
+				t.Errorf("SelectTag() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// same key always lands on same tag, keys are spread as per weights
+	split := []*entities.TagWeight{{Tag: "v1", Weight: 90}, {Tag: "v2", Weight: 10}}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		key := string(rune('a'+i%26)) + string(rune('a'+i/26))
+		tag := SelectTag(split, "shop", key)
+		if again := SelectTag(split, "shop", key); again != tag {
+			t.Fatalf("key %v selected %v and %v", key, tag, again)
+		}
+		counts[tag]++
+	}
+	if counts["v1"] < counts["v2"] || counts["v2"] == 0 {
+		t.Errorf("unexpected spread %v", counts)
+	}
+}
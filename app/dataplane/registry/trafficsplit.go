@@ -0,0 +1,35 @@
+package registry
+
+import (
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/niharrathod/ruleengine/app/entities"
+)
+
+// SelectTag picks tag of traffic split for an evaluation, split weights sum up to 100.
+// Non empty key is hashed along with ruleEngineName onto one of 100 buckets, hence same key always lands on same tag
+// as long as split is unchanged. Buckets are assigned in split order, so growing weight of first tag moves
+// only keys of other tags. Empty key picks random bucket.
+func SelectTag(split []*entities.TagWeight, ruleEngineName string, key string) string {
+	if len(split) == 0 {
+		return ""
+	}
+
+	var bucket uint
+	if key == "" {
+		bucket = uint(rand.Intn(100))
+	} else {
+		h := fnv.New32a()
+		h.Write([]byte(ruleEngineName + "/" + key))
+		bucket = uint(h.Sum32() % 100)
+	}
+
+	for _, tw := range split {
+		if bucket < tw.Weight {
+			return tw.Tag
+		}
+		bucket -= tw.Weight
+	}
+	return split[len(split)-1].Tag
+}
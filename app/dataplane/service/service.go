@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/validator"
+)
+
+// Service for data plane operations
+type Service struct {
+	store       datastore.Store
+	ruleEngines *registry.Registry
+
+	// bounds and tracks in-flight shadow evaluations
+	shadows  chan struct{}
+	inflight sync.WaitGroup
+}
+
+func New(store datastore.Store, ruleEngines *registry.Registry) *Service {
+	return &Service{store: store, ruleEngines: ruleEngines, shadows: make(chan struct{}, maxInflightShadows)}
+}
+
+// Evaluate evaluates input against the tagged RuleEngine, tag is either tag name, alias or @sha256:<hex> digest reference.
+// in case of empty tag, traffic split is considered if set, otherwise defaultTag. Response reports tag which served.
+// Evaluations without tag are also shadowed against shadow tag, if set.
+func (s *Service) Evaluate(ctx context.Context, ruleEngineName string, tag string, request *entities.EvaluateRequest) (*entities.EvaluateResponse, *entities.Error) {
+	if !validator.IsAlphanumericMax30(ruleEngineName) {
+		return nil, entities.NewError(entities.ErrCodeInvalidRuleEngineName)
+	}
+	if tag != "" && !validator.IsAlphanumericMax30(tag) && !digest.IsReference(tag) {
+		return nil, entities.NewError(entities.ErrCodeInvalidTagName)
+	}
+	option, err := evaluateOption(request.OpType, request.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	servedTag, engine, err := s.ruleEngines.Get(ruleEngineName, tag, request.Key)
+	if err != nil {
+		// registry might miss RuleEngine due to failed or pending sync, refreshed from datastore so that it heals
+		// without waiting for next write to RuleEngine
+		if refreshErr := s.ruleEngines.Refresh(ctx, ruleEngineName); refreshErr != nil {
+			return nil, refreshErr
+		}
+		if servedTag, engine, err = s.ruleEngines.Get(ruleEngineName, tag, request.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	results, coreErr := engine.Evaluate(ctx, request.Input, option)
+	if coreErr != nil {
+		return nil, entities.NewErrorWithMsg(entities.ErrCodeEvaluationFailed, coreErr.Error())
+	}
+
+	if tag == "" {
+		s.shadow(ruleEngineName, servedTag, request, results)
+	}
+
+	return &entities.EvaluateResponse{Tag: servedTag, Results: results}, nil
+}
+
+// maps opType and limit onto ruleengine-core evaluate option
+func evaluateOption(opType string, limit uint) (*ruleenginecore.EvaluateOption, *entities.Error) {
+	switch opType {
+	case "", entities.OpTypeComplete:
+		if limit != 0 {
+			return nil, entities.NewErrorWithMsg(entities.ErrCodeInvalidEvaluateOption, "limit is not allowed for Complete opType")
+		}
+		return ruleenginecore.EvaluateOptions().Complete(), nil
+	case entities.OpTypeAscPriority:
+		if limit == 0 {
+			return nil, entities.NewErrorWithMsg(entities.ErrCodeInvalidEvaluateOption, "limit is mandatory for AscPriority opType")
+		}
+		return ruleenginecore.EvaluateOptions().AscendingPriorityBased(limit), nil
+	case entities.OpTypeDscPriority:
+		if limit == 0 {
+			return nil, entities.NewErrorWithMsg(entities.ErrCodeInvalidEvaluateOption, "limit is mandatory for DscPriority opType")
+		}
+		return ruleenginecore.EvaluateOptions().DescendingPriorityBased(limit), nil
+	}
+
+	return nil, entities.NewErrorWithMsg(entities.ErrCodeInvalidEvaluateOption, "opType:"+opType+" is not supported")
+}
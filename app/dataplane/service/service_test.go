@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.uber.org/zap"
+)
+
+// registry is never synced here, i.e. every evaluation starts with a registry miss as if sync had failed
+func TestEvaluateRefreshesRegistryOnMiss(t *testing.T) {
+	log.Logger = zap.NewNop()
+	config.Datastore = &config.DatastoreConf{Memory: &config.MemoryConf{}}
+	store, err := datastore.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domestic := &ruleenginecore.RuleEngineConfig{
+		Fields: ruleenginecore.Fields{"country": "string"},
+		ConditionTypes: map[string]*ruleenginecore.ConditionType{
+			"domestic": {Operator: "==", OperandType: "string", Operands: []*ruleenginecore.Operand{
+				{OperandAs: "field", Val: "country"},
+				{OperandAs: "constant", Val: "IN"},
+			}},
+		},
+		Rules: map[string]*ruleenginecore.Rule{
+			"domestic": {Priority: 1, RootCondition: &ruleenginecore.Condition{ConditionType: "domestic"}, Result: map[string]any{"shipping": 0}},
+		},
+	}
+
+	ctx := context.Background()
+	steps := []func() *entities.Error{
+		func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", domestic) },
+		func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v2", domestic) },
+		func() *entities.Error { return store.EnableTag(ctx, "shop", "v1") },
+		func() *entities.Error { return store.SetDefaultTag(ctx, "shop", "v1") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := New(store, registry.New(store))
+
+	tests := []struct {
+		name       string
+		ruleEngine string
+		tag        string
+		wantTag    string
+		wantErr    uint
+	}{
+		{"default tag", "shop", "", "v1", 0},
+		{"tag", "shop", "v1", "v1", 0},
+		{"disabled tag", "shop", "v2", "", entities.ErrCodeTagNotEnabled},
+		{"unknown tag", "shop", "v9", "", entities.ErrCodeTagNotFound},
+		{"unknown RuleEngine", "cart", "", "", entities.ErrCodeRuleEngineNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := &entities.EvaluateRequest{Input: ruleenginecore.Input{"country": "IN"}}
+			response, err := s.Evaluate(ctx, tt.ruleEngine, tt.tag, request)
+			if tt.wantErr != 0 {
+				if err == nil || err.ErrCode != tt.wantErr {
+					t.Fatalf("Evaluate() error = %v, want errCode %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || response.Tag != tt.wantTag || len(response.Results) != 1 {
+				t.Errorf("Evaluate() = %+v, %v, want tag %v with 1 result", response, err, tt.wantTag)
+			}
+		})
+	}
+}
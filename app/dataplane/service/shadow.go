@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	// in-flight shadow evaluations are bounded, excess is dropped so that shadowing never holds up serving
+	maxInflightShadows = 64
+
+	shadowTimeout = 5 * time.Second
+)
+
+// shadow metrics keyed by RuleEngine name, exposed on /debug/vars
+var (
+	shadowEvaluations   = expvar.NewMap("shadowEvaluations")
+	shadowDisagreements = expvar.NewMap("shadowDisagreements")
+	shadowFailures      = expvar.NewMap("shadowFailures")
+	shadowDropped       = expvar.NewMap("shadowDropped")
+)
+
+// WriteShadowMetrics writes shadow metrics as JSON object in expvar format. Only shadow metrics are written,
+// i.e. process details of expvar such as cmdline and memstats are not exposed.
+func WriteShadowMetrics(w io.Writer) {
+	fmt.Fprintf(w, "{\n%q: %v,\n%q: %v,\n%q: %v,\n%q: %v\n}\n",
+		"shadowEvaluations", shadowEvaluations,
+		"shadowDisagreements", shadowDisagreements,
+		"shadowFailures", shadowFailures,
+		"shadowDropped", shadowDropped)
+}
+
+// shadow evaluates request against shadow tag asynchronously, in case shadow tag is set and differs from served tag.
+// Disagreement i.e. differing set of matched rules is recorded in datastore.
+func (s *Service) shadow(ruleEngineName string, servedTag string, request *entities.EvaluateRequest, served []*ruleenginecore.Output) {
+	shadowTag, engine, found := s.ruleEngines.Shadow(ruleEngineName)
+	if !found || shadowTag == servedTag {
+		return
+	}
+
+	select {
+	case s.shadows <- struct{}{}:
+	default:
+		shadowDropped.Add(ruleEngineName, 1)
+		return
+	}
+
+	s.inflight.Add(1)
+	go func() {
+		defer func() {
+			<-s.shadows
+			s.inflight.Done()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+		defer cancel()
+
+		shadowEvaluations.Add(ruleEngineName, 1)
+
+		// option carries evaluation state, hence a fresh one
+		option, _ := evaluateOption(request.OpType, request.Limit)
+		results, coreErr := engine.Evaluate(ctx, request.Input, option)
+		if coreErr != nil {
+			shadowFailures.Add(ruleEngineName, 1)
+			log.Logger.Warn("Shadow evaluation failed", zap.String("RuleEngine", ruleEngineName), zap.String("Tag", shadowTag), zap.String("Error", coreErr.Error()))
+			return
+		}
+
+		servedRules, shadowRules := ruleNames(served), ruleNames(results)
+		if equal(servedRules, shadowRules) {
+			return
+		}
+
+		shadowDisagreements.Add(ruleEngineName, 1)
+		disagreement := &entities.ShadowDisagreement{
+			ID:          primitive.NewObjectID(),
+			RuleEngine:  ruleEngineName,
+			ServedTag:   servedTag,
+			ShadowTag:   shadowTag,
+			Input:       request.Input,
+			ServedRules: servedRules,
+			ShadowRules: shadowRules,
+			CreateTime:  time.Now().Unix(),
+		}
+		if err := s.store.SaveShadowDisagreement(ctx, disagreement); err != nil {
+			shadowFailures.Add(ruleEngineName, 1)
+			log.Logger.Error("Shadow disagreement save failed", zap.String("RuleEngine", ruleEngineName), zap.String("Error", err.Error()))
+		}
+	}()
+}
+
+// Stop waits for in-flight shadow evaluations to finish
+func (s *Service) Stop(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Logger.Warn("Shadow evaluations did not finish in time")
+	}
+}
+
+// sorted names of matched rules
+func ruleNames(outputs []*ruleenginecore.Output) []string {
+	names := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		names = append(names, output.Rulename)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
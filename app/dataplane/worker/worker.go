@@ -0,0 +1,275 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/dataplane/registry"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/ext/datastore"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	retryInterval       = time.Second
+	closeTimeout        = time.Second
+
+	// lastUpdateTime is set by any replica, polling considers clock skew among replicas
+	clockSkewAllowanceSec = 5
+)
+
+// Worker observes changes in datastore and syncs RuleEngine instances of registry accordingly,
+// i.e. every replica converges on control plane changes.
+//
+// Change stream is used to observe changes, with resume token persisted per worker.
+// In case store is not a ChangeStreamer or change streams are not supported, datastore is polled based on lastUpdateTime.
+type Worker struct {
+	id           string
+	pollInterval time.Duration
+	store        datastore.Store
+	registry     *registry.Registry
+
+	// nil in case store is not capable of streaming changes
+	streamer datastore.ChangeStreamer
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func New(store datastore.Store, r *registry.Registry) *Worker {
+	id := config.Worker.ID
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Logger.Warn("Could not resolve hostname as worker id", zap.String("error", err.Error()))
+		}
+		id = hostname
+	}
+
+	pollInterval := time.Duration(config.Worker.PollIntervalSec) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	return &Worker{
+		id:           id,
+		pollInterval: pollInterval,
+		store:        store,
+		registry:     r,
+		done:         make(chan struct{}),
+	}
+}
+
+// Start loads every RuleEngine in registry and starts observing changes in background.
+func (w *Worker) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+
+	var stream datastore.ChangeStream
+	var resumeToken []byte
+	if streamer, ok := w.store.(datastore.ChangeStreamer); ok {
+		w.streamer = streamer
+
+		var dsErr *entities.Error
+		if resumeToken, dsErr = streamer.GetResumeToken(ctx, w.id); dsErr != nil {
+			cancel()
+			return dsErr
+		}
+
+		// change stream is opened before load, so that changes during load are not missed
+		var err error
+		stream, err = streamer.WatchRuleEngines(ctx, resumeToken)
+		if errors.Is(err, datastore.ErrResumeTokenExpired) {
+			log.Logger.Warn("Resume token expired, watching from now", zap.String("WorkerID", w.id))
+			resumeToken = nil
+			stream, err = streamer.WatchRuleEngines(ctx, nil)
+		}
+		if err != nil && !errors.Is(err, datastore.ErrChangeStreamNotSupported) {
+			cancel()
+			return err
+		}
+	}
+
+	loadTime := time.Now().Unix()
+	if dsErr := w.load(ctx); dsErr != nil {
+		if stream != nil {
+			w.closeStream(stream)
+		}
+		cancel()
+		return dsErr
+	}
+
+	if stream == nil {
+		log.Logger.Warn("Change stream not available, polling for changes", zap.String("WorkerID", w.id), zap.Duration("PollInterval", w.pollInterval))
+		go w.poll(ctx, loadTime)
+	} else {
+		log.Logger.Info("Watching RuleEngine changes", zap.String("WorkerID", w.id))
+		go w.watch(ctx, stream, resumeToken)
+	}
+	return nil
+}
+
+// Stop stops observing changes, waits for background processing to finish or ctx to be done.
+func (w *Worker) Stop(ctx context.Context) {
+	log.Logger.Info("Worker stopping", zap.String("WorkerID", w.id))
+	w.cancel()
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		log.Logger.Error("Worker stop timed out", zap.String("WorkerID", w.id))
+	}
+}
+
+func (w *Worker) watch(ctx context.Context, stream datastore.ChangeStream, resumeToken []byte) {
+	defer close(w.done)
+
+	for {
+		change, err := stream.Next(ctx)
+		if err != nil {
+			w.closeStream(stream)
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Logger.Error("Change stream failed, reopening", zap.String("WorkerID", w.id), zap.String("error", err.Error()))
+			if errors.Is(err, datastore.ErrChangeStreamInvalidated) {
+				resumeToken = nil
+			}
+			if stream = w.reopen(ctx, resumeToken); stream == nil {
+				return
+			}
+			continue
+		}
+
+		w.apply(ctx, change.RuleEngine)
+
+		resumeToken = change.ResumeToken
+		if err := w.streamer.SaveResumeToken(ctx, w.id, resumeToken); err != nil && ctx.Err() == nil {
+			log.Logger.Error("Resume token persist failed", zap.String("WorkerID", w.id), zap.String("error", err.Error()))
+		}
+	}
+}
+
+// reopens change stream after resumeToken till it succeeds, nil in case ctx is done.
+func (w *Worker) reopen(ctx context.Context, resumeToken []byte) datastore.ChangeStream {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryInterval):
+		}
+
+		stream, err := w.streamer.WatchRuleEngines(ctx, resumeToken)
+		if errors.Is(err, datastore.ErrResumeTokenExpired) {
+			log.Logger.Warn("Resume token expired, watching from now", zap.String("WorkerID", w.id))
+			resumeToken = nil
+			stream, err = w.streamer.WatchRuleEngines(ctx, nil)
+		}
+		if err != nil {
+			log.Logger.Error("Change stream reopen failed", zap.String("WorkerID", w.id), zap.String("error", err.Error()))
+			continue
+		}
+
+		// without resumeToken, changes since failure are unknown
+		if resumeToken == nil {
+			if dsErr := w.load(ctx); dsErr != nil {
+				log.Logger.Error("RuleEngine registry load failed", zap.String("WorkerID", w.id), zap.String("error", dsErr.Error()))
+			}
+		}
+		return stream
+	}
+}
+
+func (w *Worker) poll(ctx context.Context, since int64) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pollTime := time.Now().Unix()
+		ruleEngines, err := w.store.GetRuleEnginesUpdatedSince(ctx, since-clockSkewAllowanceSec)
+		if err != nil {
+			log.Logger.Error("Poll RuleEngine changes failed", zap.String("WorkerID", w.id), zap.String("error", err.Error()))
+			continue
+		}
+
+		for _, ruleEngine := range ruleEngines {
+			w.apply(ctx, ruleEngine)
+		}
+		w.removeDeleted(ctx)
+
+		since = pollTime
+	}
+}
+
+// load syncs every RuleEngine from datastore, RuleEngine failing to sync is skipped so that others are still served
+func (w *Worker) load(ctx context.Context) *entities.Error {
+	ruleEngines, err := w.store.GetAllRuleEngines(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, ruleEngine := range ruleEngines {
+		w.apply(ctx, ruleEngine)
+	}
+	w.removeDeleted(ctx)
+	return nil
+}
+
+// apply syncs registry with changed RuleEngine, nil ruleEngine is considered as deleted.
+func (w *Worker) apply(ctx context.Context, ruleEngine *entities.RuleEngine) {
+	if ruleEngine == nil {
+		// deleted RuleEngine name is unknown, identify by comparing with datastore
+		w.removeDeleted(ctx)
+		return
+	}
+
+	if err := w.registry.Sync(ctx, ruleEngine.Name, ruleEngine); err != nil {
+		log.Logger.Error("RuleEngine registry sync failed", zap.String("RuleEngine", ruleEngine.Name), zap.String("error", err.Error()))
+	}
+}
+
+// removeDeleted discards instances of RuleEngines which are not in datastore anymore
+func (w *Worker) removeDeleted(ctx context.Context) {
+	names, err := w.store.GetRuleEngineNames(ctx)
+	if err != nil {
+		log.Logger.Error("Get RuleEngine names failed", zap.String("WorkerID", w.id), zap.String("error", err.Error()))
+		return
+	}
+
+	existing := map[string]bool{}
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	for _, name := range w.registry.Names() {
+		if existing[name] {
+			continue
+		}
+		// refresh instead of remove, RuleEngine might be created meanwhile
+		if err := w.registry.Refresh(ctx, name); err != nil {
+			log.Logger.Error("RuleEngine registry refresh failed", zap.String("RuleEngine", name), zap.String("error", err.Error()))
+		}
+	}
+}
+
+func (w *Worker) closeStream(stream datastore.ChangeStream) {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if err := stream.Close(ctx); err != nil {
+		log.Logger.Warn("Change stream close failed", zap.String("WorkerID", w.id), zap.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,93 @@
+package digest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+)
+
+// Algorithm is prefix of every digest, i.e. sha256:<hex>
+const Algorithm = "sha256:"
+
+// ReferencePrefix distinguishes digest reference from tag name, i.e. @sha256:<hex>
+const ReferencePrefix = "@"
+
+// Of computes content digest of RuleEngineConfig. Config is canonicalized first, i.e. object keys are sorted and
+// null values, empty arrays and empty objects are dropped, so that semantically identical configs share a digest.
+func Of(config *ruleenginecore.RuleEngineConfig) (string, error) {
+	canonical, err := Canonical(config)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+	return Algorithm + hex.EncodeToString(sum[:]), nil
+}
+
+// Canonical json encoding of val, i.e. object keys are sorted and null values, empty arrays and empty objects are dropped
+func Canonical(val interface{}) ([]byte, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+
+	// encoding/json marshals map keys in sorted order
+	return json.Marshal(canonicalize(generic))
+}
+
+// IsReference reports whether ref is a well formed digest reference, i.e. @sha256:<64 lowercase hex>
+func IsReference(ref string) bool {
+	if !strings.HasPrefix(ref, ReferencePrefix+Algorithm) {
+		return false
+	}
+
+	sum := strings.TrimPrefix(ref, ReferencePrefix+Algorithm)
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	for _, r := range sum {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// FromReference strips reference prefix, i.e. @sha256:<hex> to sha256:<hex>
+func FromReference(ref string) string {
+	return strings.TrimPrefix(ref, ReferencePrefix)
+}
+
+func canonicalize(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range v {
+			if item = canonicalize(item); item != nil {
+				result[key] = item
+			}
+		}
+		if len(result) == 0 {
+			return nil
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			result = append(result, canonicalize(item))
+		}
+		if len(result) == 0 {
+			return nil
+		}
+		return result
+	}
+	return val
+}
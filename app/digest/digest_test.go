@@ -0,0 +1,79 @@
+package digest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+)
+
+// seniorConfig gives discount to age of 60 and above, test cases derive their configs from it
+const seniorConfig = `{"fields":{"age":"int","city":"string"},"conditionTypes":{"senior":{"operator":">=","operandType":"int","operands":[{"operandAs":"field","val":"age"},{"operandAs":"constant","val":"60"}]}},"rules":{"senior":{"priority":1,"condition":{"conditionType":"senior"},"result":{"discount":15}}}}`
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		same   bool
+	}{
+		{"identical", seniorConfig, true},
+		{"reordered keys", `{"rules":{"senior":{"result":{"discount":15},"condition":{"conditionType":"senior"},"priority":1}},"fields":{"city":"string","age":"int"},"conditionTypes":{"senior":{"operands":[{"val":"age","operandAs":"field"},{"val":"60","operandAs":"constant"}],"operandType":"int","operator":">="}}}`, true},
+		{"empty subconditions dropped", strings.Replace(seniorConfig, `"conditionType":"senior"}`, `"conditionType":"senior","subConditions":[]}`, 1), true},
+		{"changed result", strings.Replace(seniorConfig, `"discount":15`, `"discount":20`, 1), false},
+		{"changed priority", strings.Replace(seniorConfig, `"priority":1`, `"priority":2`, 1), false},
+	}
+
+	of := func(t *testing.T, data string) string {
+		t.Helper()
+		var config ruleenginecore.RuleEngineConfig
+		if err := json.Unmarshal([]byte(data), &config); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := Of(&config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+
+	base := of(t, seniorConfig)
+	if !IsReference(ReferencePrefix + base) {
+		t.Fatalf("digest %v is not well formed", base)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := of(t, tt.config); (got == base) != tt.same {
+				t.Errorf("Of() = %v, base %v, want same %v", got, base, tt.same)
+			}
+		})
+	}
+}
+
+func TestIsReference(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	tests := []struct {
+		name string
+		ref  string
+		want bool
+	}{
+		{"valid", "@sha256:" + sum, true},
+		{"without prefix", "sha256:" + sum, false},
+		{"tag name", "v1", false},
+		{"short", "@sha256:" + sum[:62], false},
+		{"long", "@sha256:" + sum + "ab", false},
+		{"uppercase hex", "@sha256:" + strings.ToUpper(sum), false},
+		{"other algorithm", "@sha512:" + sum, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsReference(tt.ref); got != tt.want {
+				t.Errorf("IsReference(%v) = %v, want %v", tt.ref, got, tt.want)
+			}
+		})
+	}
+
+	if got := FromReference("@sha256:" + sum); got != "sha256:"+sum {
+		t.Errorf("FromReference() = %v", got)
+	}
+}
@@ -12,12 +12,56 @@ type RuleEngine struct {
 	DefaultTag     string          `bson:"defaultTag"`
 	Tags           map[string]*Tag `bson:"tags"`
 	LastUpdateTime int64           `bson:"lastUpdateTime"`
+
+	// incremented on every write, i.e. orders changes made within same second
+	Version int64 `bson:"version"`
+
+	// assigned when RuleEngine is created or renamed, i.e. RuleEngine recreated on a name is a newer incarnation
+	// even though its version starts over. ObjectID, hence ordered by assignment time
+	Incarnation primitive.ObjectID `bson:"incarnation"`
+
+	// map of alias and tag, aliased tag is always enabled
+	Aliases map[string]string `bson:"aliases"`
+
+	// weighted routing of evaluations without tag, takes precedence over defaultTag. every tag is enabled
+	TrafficSplit []*TagWeight `bson:"trafficSplit"`
+
+	// enabled tag evaluated asynchronously alongside evaluations without tag, empty if not set
+	ShadowTag string `bson:"shadowTag"`
+
+	// earliest pending activateAt/expireAt among tags, 0 if nothing is scheduled
+	NextScheduleTime int64 `bson:"nextScheduleTime"`
+
+	// replaced default tags for rollback, most recent last
+	DefaultTagHistory []string `bson:"defaultTagHistory"`
+}
+
+// TagWeight is share of traffic, in percentage, routed to tag
+type TagWeight struct {
+	Tag    string `bson:"tag" json:"tag"`
+	Weight uint   `bson:"weight" json:"weight"`
+}
+
+type TrafficSplitRequest struct {
+	Tags []*TagWeight `json:"tags"`
 }
 
 type Tag struct {
 	Name           string             `bson:"name"`
 	EngineConfigID primitive.ObjectID `bson:"engineConfigId"`
 	IsEnable       bool               `bson:"isEnable"`
+
+	// content digest of RuleEngineConfig, i.e. sha256:<hex>
+	Digest string `bson:"digest"`
+
+	// unix time to enable tag and set as default, 0 if not scheduled or already activated
+	ActivateAt int64 `bson:"activateAt"`
+
+	// unix time to revert default to PreviousDefaultTag and disable tag, 0 if not scheduled
+	ExpireAt int64 `bson:"expireAt"`
+
+	// default tag replaced by scheduled activation
+	PreviousDefaultTag string `bson:"previousDefaultTag"`
 }
 
 type EngineConfig struct {
@@ -29,13 +73,375 @@ type CompleteRuleEngine struct {
 	Name       string                  `json:"name"`
 	DefaultTag string                  `json:"defaultTag"`
 	Tags       map[string]*TagResponse `json:"tags"`
+	Aliases    map[string]string       `json:"aliases"`
+
+	TrafficSplit []*TagWeight `json:"trafficSplit"`
+	ShadowTag    string       `json:"shadowTag"`
+
+	// replaced default tags, most recent last i.e. next rollback target
+	DefaultTagHistory []string `json:"defaultTagHistory"`
 }
 
-type TagResponse struct {
+type RollbackResponse struct {
+	// restored default tag
+	DefaultTag string `json:"defaultTag"`
+}
+
+// CloneRequest is target of clone, RuleEngine defaults to source RuleEngine
+type CloneRequest struct {
+	RuleEngine string `json:"ruleEngine"`
+	Tag        string `json:"tag"`
+}
+
+// RuleEngineSpec is complete state of RuleEngine independent of datastore records, i.e. portable between environments
+type RuleEngineSpec struct {
+	Name         string              `json:"name"`
+	DefaultTag   string              `json:"defaultTag"`
+	Tags         map[string]*TagSpec `json:"tags"`
+	Aliases      map[string]string   `json:"aliases,omitempty"`
+	TrafficSplit []*TagWeight        `json:"trafficSplit,omitempty"`
+	ShadowTag    string              `json:"shadowTag,omitempty"`
+}
+
+type TagSpec struct {
 	IsEnable bool                             `json:"isEnable"`
 	Config   *ruleenginecore.RuleEngineConfig `json:"config"`
 }
 
+// RuleEngineArchive is produced by export and consumed by import
+type RuleEngineArchive struct {
+	ExportTime  int64             `json:"exportTime"`
+	RuleEngines []*RuleEngineSpec `json:"ruleEngines"`
+}
+
+// Import conflict policies, i.e. handling of RuleEngine which already exist
+const (
+	ImportPolicySkip      = "skip"
+	ImportPolicyOverwrite = "overwrite"
+	ImportPolicyFail      = "fail"
+)
+
+type ImportResult struct {
+	Created     []string `json:"created"`
+	Overwritten []string `json:"overwritten"`
+	Skipped     []string `json:"skipped"`
+}
+
+// ApplyRequest is desired state of RuleEngine, tags not declared are deleted. aliases, traffic split and shadow tag
+// are applied only if present(empty value removes them), absent ones are kept as is.
+type ApplyRequest struct {
+	DefaultTag   string              `json:"defaultTag"`
+	Tags         map[string]*TagSpec `json:"tags"`
+	Aliases      map[string]string   `json:"aliases"`
+	TrafficSplit []*TagWeight        `json:"trafficSplit"`
+	ShadowTag    *string             `json:"shadowTag"`
+}
+
+// ApplyOptions of declarative apply, kept routing is taken as stored instead of from desired spec
+type ApplyOptions struct {
+	DryRun           bool
+	KeepAliases      bool
+	KeepTrafficSplit bool
+	KeepShadowTag    bool
+}
+
+// PlanStep is a change of RuleEngine, operation is one of audit operations of tag
+type PlanStep struct {
+	Operation string `json:"operation"`
+	Tag       string `json:"tag,omitempty"`
+
+	// config digest of created or updated tag
+	Digest string `json:"digest,omitempty"`
+
+	// same as audit event detail, i.e. alias name of alias steps, tag:weight list of traffic split step
+	Detail string `json:"detail,omitempty"`
+}
+
+type ApplyPlan struct {
+	RuleEngine string `json:"ruleEngine"`
+	DryRun     bool   `json:"dryRun"`
+
+	// in execution order, empty in case RuleEngine is already as desired
+	Steps []*PlanStep `json:"steps"`
+}
+
+// GitOps file reconcile status
+const (
+	GitOpsInSync     = "InSync"
+	GitOpsReconciled = "Reconciled"
+	GitOpsInvalid    = "Invalid"
+	GitOpsFailed     = "Failed"
+)
+
+// GitOpsStatus is outcome of last reconciliation of gitops directory
+type GitOpsStatus struct {
+	Dir               string              `json:"dir"`
+	LastReconcileTime int64               `json:"lastReconcileTime"`
+	Files             []*GitOpsFileStatus `json:"files"`
+}
+
+type GitOpsFileStatus struct {
+	File       string `json:"file"`
+	RuleEngine string `json:"ruleEngine,omitempty"`
+	Status     string `json:"status"`
+
+	// differences of RuleEngine from file found by last check, as plan executed to reconcile them
+	Drift []*PlanStep `json:"drift,omitempty"`
+
+	// parsing, validation or datastore failure, nil unless Invalid or Failed
+	Error *Error `json:"error,omitempty"`
+}
+
+// RenameRequest is new name of RuleEngine or tag
+type RenameRequest struct {
+	Name string `json:"name"`
+}
+
+// ScheduleRequest schedules tag activation and/or expiry as unix time, 0 as not scheduled
+type ScheduleRequest struct {
+	ActivateAt int64 `json:"activateAt"`
+	ExpireAt   int64 `json:"expireAt"`
+}
+
+// Audit operations
+const (
+	AuditOpCreateTag           = "CreateTag"
+	AuditOpCloneTag            = "CloneTag"
+	AuditOpRenameTag           = "RenameTag"
+	AuditOpUpdateTagConfig     = "UpdateTagConfig"
+	AuditOpDeleteTag           = "DeleteTag"
+	AuditOpDeleteRuleEngine    = "DeleteRuleEngine"
+	AuditOpRenameRuleEngine    = "RenameRuleEngine"
+	AuditOpImportRuleEngine    = "ImportRuleEngine"
+	AuditOpSetDefaultTag       = "SetDefaultTag"
+	AuditOpRemoveDefaultTag    = "RemoveDefaultTag"
+	AuditOpRollbackDefaultTag  = "RollbackDefaultTag"
+	AuditOpEnableTag           = "EnableTag"
+	AuditOpDisableTag          = "DisableTag"
+	AuditOpSetAlias            = "SetAlias"
+	AuditOpDeleteAlias         = "DeleteAlias"
+	AuditOpSetTrafficSplit     = "SetTrafficSplit"
+	AuditOpSetShadowTag        = "SetShadowTag"
+	AuditOpSetTagSchedule      = "SetTagSchedule"
+	AuditOpScheduledActivation = "ScheduledActivation"
+	AuditOpScheduledExpiry     = "ScheduledExpiry"
+)
+
+// AuditEvent records control plane change of RuleEngine, retained even after RuleEngine is deleted
+type AuditEvent struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Operation  string             `bson:"operation" json:"operation"`
+	RuleEngine string             `bson:"ruleEngine" json:"ruleEngine"`
+	Tag        string             `bson:"tag" json:"tag,omitempty"`
+	Actor      string             `bson:"actor" json:"actor"`
+	RequestID  string             `bson:"requestId" json:"requestId,omitempty"`
+	Timestamp  int64              `bson:"timestamp" json:"timestamp"`
+
+	// operation specific detail, ex: alias name, former name of renamed RuleEngine or tag
+	Detail string `bson:"detail" json:"detail,omitempty"`
+
+	// nil in case RuleEngine did not exist before or does not exist after change
+	Before *AuditState `bson:"before" json:"before"`
+	After  *AuditState `bson:"after" json:"after"`
+}
+
+// AuditState is default tag and enable state of audited tag
+type AuditState struct {
+	DefaultTag string `bson:"defaultTag" json:"defaultTag"`
+
+	// nil in case no tag is audited or tag does not exist
+	TagEnabled *bool `bson:"tagEnabled" json:"tagEnabled,omitempty"`
+}
+
+type AuditEventList struct {
+	Events     []*AuditEvent `json:"events"`
+	NextCursor string        `json:"nextCursor"`
+}
+
+// ConfigDiff is structured difference of RuleEngineConfigs of two tags, from as base
+type ConfigDiff struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	FromDigest string `json:"fromDigest"`
+	ToDigest   string `json:"toDigest"`
+
+	// configs are canonically identical, rest of the diff is empty
+	Identical bool `json:"identical"`
+
+	Fields         *FieldsDiff         `json:"fields"`
+	ConditionTypes *ConditionTypesDiff `json:"conditionTypes"`
+	Rules          *RulesDiff          `json:"rules"`
+}
+
+// FieldsDiff as map of fieldname and field type
+type FieldsDiff struct {
+	Added       map[string]string           `json:"added"`
+	Removed     map[string]string           `json:"removed"`
+	TypeChanged map[string]*FieldTypeChange `json:"typeChanged"`
+}
+
+type FieldTypeChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ConditionTypesDiff as sorted conditionType names
+type ConditionTypesDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// RulesDiff as sorted rule names and changes of rules present in both configs
+type RulesDiff struct {
+	Added   []string               `json:"added"`
+	Removed []string               `json:"removed"`
+	Changed map[string]*RuleChange `json:"changed"`
+}
+
+// RuleChange of rule, nil in case respective part is unchanged
+type RuleChange struct {
+	Priority  *PriorityChange  `json:"priority,omitempty"`
+	Condition *ConditionChange `json:"condition,omitempty"`
+	Result    *ResultChange    `json:"result,omitempty"`
+}
+
+type PriorityChange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type ConditionChange struct {
+	From *ruleenginecore.Condition `json:"from"`
+	To   *ruleenginecore.Condition `json:"to"`
+}
+
+// ResultChange as result keys added, removed and changed along with values
+type ResultChange struct {
+	Added   map[string]any          `json:"added"`
+	Removed map[string]any          `json:"removed"`
+	Changed map[string]*ValueChange `json:"changed"`
+}
+
+type ValueChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+type ShadowRequest struct {
+	Tag string `json:"tag"`
+}
+
+// ShadowDisagreement is an evaluation where shadow tag matched different rules than served tag
+type ShadowDisagreement struct {
+	ID          primitive.ObjectID   `bson:"_id" json:"id"`
+	RuleEngine  string               `bson:"ruleEngine" json:"ruleEngine"`
+	ServedTag   string               `bson:"servedTag" json:"servedTag"`
+	ShadowTag   string               `bson:"shadowTag" json:"shadowTag"`
+	Input       ruleenginecore.Input `bson:"input" json:"input"`
+	ServedRules []string             `bson:"servedRules" json:"servedRules"`
+	ShadowRules []string             `bson:"shadowRules" json:"shadowRules"`
+	CreateTime  int64                `bson:"createTime" json:"createTime"`
+}
+
+type ShadowDisagreementList struct {
+	Disagreements []*ShadowDisagreement `json:"disagreements"`
+	NextCursor    string                `json:"nextCursor"`
+}
+
+type AliasRequest struct {
+	Tag string `json:"tag"`
+}
+
+type AliasResponse struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+}
+
+type TagResponse struct {
+	IsEnable   bool                             `json:"isEnable"`
+	Digest     string                           `json:"digest"`
+	ActivateAt int64                            `json:"activateAt,omitempty"`
+	ExpireAt   int64                            `json:"expireAt,omitempty"`
+	Config     *ruleenginecore.RuleEngineConfig `json:"config,omitempty"`
+}
+
+// NewTagResponse of tag, nil config is omitted from response
+func NewTagResponse(tag *Tag, config *ruleenginecore.RuleEngineConfig) *TagResponse {
+	return &TagResponse{
+		IsEnable:   tag.IsEnable,
+		Digest:     tag.Digest,
+		ActivateAt: tag.ActivateAt,
+		ExpireAt:   tag.ExpireAt,
+		Config:     config,
+	}
+}
+
+// List sort fields
+const (
+	SortByName           = "name"
+	SortByLastUpdateTime = "lastUpdateTime"
+)
+
+// ListRuleEnginesQuery filters, sorts and paginates RuleEngines, pagination is keyset based i.e. after cursor position.
+type ListRuleEnginesQuery struct {
+	NamePrefix string
+	SortBy     string
+	Descending bool
+	Limit      int
+
+	// cursor position, considered only if HasCursor
+	HasCursor           bool
+	AfterName           string
+	AfterLastUpdateTime int64
+}
+
+type RuleEngineSummary struct {
+	Name           string   `json:"name"`
+	DefaultTag     string   `json:"defaultTag"`
+	TagCount       int      `json:"tagCount"`
+	EnabledTags    []string `json:"enabledTags"`
+	LastUpdateTime int64    `json:"lastUpdateTime"`
+}
+
+type RuleEngineList struct {
+	RuleEngines []*RuleEngineSummary `json:"ruleEngines"`
+
+	// empty in case of last page
+	NextCursor string `json:"nextCursor"`
+}
+
+// Evaluate operation types
+const (
+	// all rules are evaluated without any priority consideration
+	OpTypeComplete = "Complete"
+
+	// first 'limit' matched rules in ascending priority order
+	OpTypeAscPriority = "AscPriority"
+
+	// first 'limit' matched rules in descending priority order
+	OpTypeDscPriority = "DscPriority"
+)
+
+type EvaluateRequest struct {
+	Input ruleenginecore.Input `json:"input"`
+
+	// optional, defaults to Complete
+	OpType string `json:"opType"`
+
+	// mandatory for AscPriority and DscPriority opType, not allowed for Complete
+	Limit uint `json:"limit"`
+
+	// optional, caller key for sticky traffic split assignment, i.e. same key is always routed to same tag
+	Key string `json:"key"`
+}
+
+type EvaluateResponse struct {
+	// tag which served the evaluation
+	Tag     string                   `json:"tag"`
+	Results []*ruleenginecore.Output `json:"results"`
+}
+
 type Error struct {
 	ErrCode  uint   `json:"errCode"`
 	ErrMsg   string `json:"errMsg"`
@@ -84,6 +490,26 @@ const (
 	ErrCodeDefaultTagExistAndMustBeEnabled = 10
 	ErrCodeTagAlreadyExist                 = 11
 	ErrCodeEvaluationFailed                = 12
+	ErrCodeDefaultTagNotSet                = 13
+	ErrCodeTagNotEnabled                   = 14
+	ErrCodeInvalidEvaluateOption           = 15
+	ErrCodeInvalidListQuery                = 16
+	ErrCodeInvalidFieldsQuery              = 17
+	ErrCodeTagUpdateNotAllowed             = 18
+	ErrCodeInvalidAliasName                = 19
+	ErrCodeAliasNotFound                   = 20
+	ErrCodeAliasTagMustBeEnabled           = 21
+	ErrCodeAliasConflict                   = 22
+	ErrCodeInvalidTrafficSplit             = 23
+	ErrCodeShadowTagMustBeEnabled          = 24
+	ErrCodeInvalidPageQuery                = 25
+	ErrCodeInvalidSchedule                 = 26
+	ErrCodeNoPreviousDefaultTag            = 27
+	ErrCodePreviousDefaultTagDeleted       = 28
+	ErrCodeInvalidDiffQuery                = 29
+	ErrCodeRuleEngineAlreadyExist          = 30
+	ErrCodeInvalidImport                   = 31
+	ErrCodeInvalidApplyQuery               = 32
 )
 
 var errCodeToMessage = map[uint]string{
@@ -94,8 +520,29 @@ var errCodeToMessage = map[uint]string{
 	ErrCodeDatastoreFailed:                 "Internal datastore failure",
 	ErrCodeRuleEngineNotFound:              "RuleEngine not found",
 	ErrCodeTagNotFound:                     "Tag not found",
-	ErrCodeTagDeleteNotAllowed:             "Could not delete tag, either set as default or enabled",
-	ErrCodeTagDisableNotAllowed:            "Could not disable default tag",
+	ErrCodeTagDeleteNotAllowed:             "Could not delete tag, either set as default, aliased, shadow, part of traffic split or enabled",
+	ErrCodeTagDisableNotAllowed:            "Could not disable tag, either set as default, aliased, shadow or part of traffic split",
 	ErrCodeDefaultTagExistAndMustBeEnabled: "Could not set defaultTag, either not found or not enabled",
 	ErrCodeTagAlreadyExist:                 "Tag already exist",
+	ErrCodeEvaluationFailed:                "RuleEngine evaluation failed",
+	ErrCodeDefaultTagNotSet:                "Default tag is not set",
+	ErrCodeTagNotEnabled:                   "Tag is not enabled",
+	ErrCodeInvalidEvaluateOption:           "Invalid evaluate option. opType must be Complete, AscPriority or DscPriority, limit(>0) is allowed only for AscPriority and DscPriority",
+	ErrCodeInvalidListQuery:                "Invalid list query. sort must be name or lastUpdateTime, order must be asc or desc, limit must be between 1 and 100",
+	ErrCodeInvalidFieldsQuery:              "Invalid fields query. only summary is allowed",
+	ErrCodeTagUpdateNotAllowed:             "Could not update tag, either set as default or enabled",
+	ErrCodeInvalidAliasName:                "Invalid alias. alphabetic([a-z][A-Z]) and maximum 30 characters allowed",
+	ErrCodeAliasNotFound:                   "Alias not found",
+	ErrCodeAliasTagMustBeEnabled:           "Could not set alias, tag either not found or not enabled",
+	ErrCodeAliasConflict:                   "Alias and tag names must be distinct",
+	ErrCodeInvalidTrafficSplit:             "Invalid traffic split. tags must be distinct and enabled, weights must be positive and sum up to 100",
+	ErrCodeShadowTagMustBeEnabled:          "Could not set shadow tag, either not found or not enabled",
+	ErrCodeInvalidPageQuery:                "Invalid page query. limit must be between 1 and 100, cursor must be nextCursor of previous page",
+	ErrCodeInvalidSchedule:                 "Invalid schedule. activateAt or expireAt is required, expireAt must be in future and after activateAt",
+	ErrCodeNoPreviousDefaultTag:            "Could not rollback, no previous default tag",
+	ErrCodePreviousDefaultTagDeleted:       "Could not rollback, previous default tag is deleted",
+	ErrCodeInvalidDiffQuery:                "Invalid diff query. from and to are required, either tag name, alias or @sha256:<hex> digest reference",
+	ErrCodeRuleEngineAlreadyExist:          "RuleEngine already exist",
+	ErrCodeInvalidImport:                   "Invalid import. policy must be skip, overwrite or fail, RuleEngine names must be distinct",
+	ErrCodeInvalidApplyQuery:               "Invalid apply query. dryRun must be true or false",
 }
@@ -0,0 +1,60 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/niharrathod/ruleengine/app/audit"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// auditStateOf tag in RuleEngine, nil in case RuleEngine does not exist
+func auditStateOf(ruleEngine *entities.RuleEngine, tag string) *entities.AuditState {
+	if ruleEngine == nil {
+		return nil
+	}
+
+	state := &entities.AuditState{DefaultTag: ruleEngine.DefaultTag}
+	if t, ok := ruleEngine.Tags[tag]; ok {
+		isEnable := t.IsEnable
+		state.TagEnabled = &isEnable
+	}
+	return state
+}
+
+// newAuditEvent of operation, actor and request ID are taken from ctx origin
+func newAuditEvent(ctx context.Context, operation string, ruleEngineName string, tag string, before *entities.AuditState, after *entities.AuditState) *entities.AuditEvent {
+	origin := audit.FromContext(ctx)
+	return &entities.AuditEvent{
+		ID:         primitive.NewObjectID(),
+		Operation:  operation,
+		RuleEngine: ruleEngineName,
+		Tag:        tag,
+		Actor:      origin.Actor,
+		RequestID:  origin.RequestID,
+		Timestamp:  time.Now().Unix(),
+		Before:     before,
+		After:      after,
+	}
+}
+
+// trafficSplitDetail as tag:weight list, empty for removed split
+func trafficSplitDetail(split []*entities.TagWeight) string {
+	weights := []string{}
+	for _, tagWeight := range split {
+		weights = append(weights, fmt.Sprintf("%v:%v", tagWeight.Tag, tagWeight.Weight))
+	}
+	return strings.Join(weights, ",")
+}
+
+// cloneDetail as source of clone, i.e. <ruleEngine>/<tag>
+func cloneDetail(ruleEngineName string, tag string) string {
+	return ruleEngineName + "/" + tag
+}
+
+func scheduleDetail(activateAt int64, expireAt int64) string {
+	return fmt.Sprintf("activateAt:%v,expireAt:%v", activateAt, expireAt)
+}
@@ -0,0 +1,49 @@
+package datastore
+
+import (
+	"context"
+	"time"
+
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.uber.org/zap"
+)
+
+// Tags stored before digests have empty digest, i.e. digest references and plan never match them.
+// Digests are backfilled from stored config at startup, RuleEngines already backfilled are left as is.
+
+// backfillDigests fills empty digests of every RuleEngine in a single transaction
+func (s *txnStore) backfillDigests(ctx context.Context) error {
+	backfilled := 0
+	err := s.backend.update(ctx, func(t tx) error {
+		ruleEngines, err := t.listRuleEngines()
+		if err != nil {
+			return err
+		}
+
+		for _, ruleEngine := range ruleEngines {
+			changed, err := fillDigests(ruleEngine, t.getConfig)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+
+			ruleEngine.LastUpdateTime = time.Now().Unix()
+			if err := t.putRuleEngine(ruleEngine); err != nil {
+				return err
+			}
+			backfilled++
+		}
+		return nil
+	})
+	if err != nil {
+		log.Logger.Error("Tag digest backfill failed", zap.String("error", err.Error()))
+		return err
+	}
+
+	if backfilled > 0 {
+		log.Logger.Info("Tag digests backfilled", zap.Int("RuleEngines", backfilled))
+	}
+	return nil
+}
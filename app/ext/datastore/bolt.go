@@ -0,0 +1,282 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	bolt "go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var (
+	ruleEngineBucket = []byte(ruleEngineCollName)
+	configBucket     = []byte(configCollName)
+
+	// nested bucket per RuleEngine, keyed by id i.e. ordered by creation
+	shadowBucket = []byte(shadowCollName)
+	auditBucket  = []byte(auditCollName)
+)
+
+// boltBackend persists records in a single bbolt data file, meant for single node deployments.
+// RuleEngine is stored as bson, RuleEngineConfig as json, keyed by name and id respectively.
+type boltBackend struct {
+	db *bolt.DB
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func newBoltStore(conf *config.BoltConf) (*txnStore, error) {
+	db, err := bolt.Open(conf.Path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		log.Logger.Error("Bolt open failed", zap.String("Path", conf.Path), zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{ruleEngineBucket, configBucket, shadowBucket, auditBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Logger.Error("Bolt bucket creation failed", zap.String("error", err.Error()))
+		db.Close()
+		return nil, err
+	}
+
+	store := &txnStore{backend: &boltBackend{db: db}}
+	if err := store.backfillDigests(context.TODO()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Logger.Info("Bolt datastore opened", zap.String("Path", conf.Path))
+	return store, nil
+}
+
+func (b *boltBackend) view(ctx context.Context, fn func(tx) error) error {
+	return b.db.View(func(t *bolt.Tx) error {
+		return fn(&boltTx{tx: t})
+	})
+}
+
+func (b *boltBackend) update(ctx context.Context, fn func(tx) error) error {
+	return b.db.Update(func(t *bolt.Tx) error {
+		return fn(&boltTx{tx: t})
+	})
+}
+
+func (b *boltBackend) close(ctx context.Context) error {
+	log.Logger.Info("Bolt datastore closing")
+	return b.db.Close()
+}
+
+func (t *boltTx) getRuleEngine(ruleEngineName string) (*entities.RuleEngine, error) {
+	data := t.tx.Bucket(ruleEngineBucket).Get([]byte(ruleEngineName))
+	if data == nil {
+		return nil, nil
+	}
+
+	var ruleEngine entities.RuleEngine
+	if err := bson.Unmarshal(data, &ruleEngine); err != nil {
+		return nil, err
+	}
+	return &ruleEngine, nil
+}
+
+// bolt keys are sorted, i.e. ordered by name
+func (t *boltTx) listRuleEngines() ([]*entities.RuleEngine, error) {
+	ruleEngines := []*entities.RuleEngine{}
+	err := t.tx.Bucket(ruleEngineBucket).ForEach(func(_, data []byte) error {
+		var ruleEngine entities.RuleEngine
+		if err := bson.Unmarshal(data, &ruleEngine); err != nil {
+			return err
+		}
+		ruleEngines = append(ruleEngines, &ruleEngine)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ruleEngines, nil
+}
+
+func (t *boltTx) putRuleEngine(ruleEngine *entities.RuleEngine) error {
+	ruleEngine.Version++
+	data, err := bson.Marshal(ruleEngine)
+	if err != nil {
+		return err
+	}
+	return t.tx.Bucket(ruleEngineBucket).Put([]byte(ruleEngine.Name), data)
+}
+
+func (t *boltTx) deleteRuleEngine(ruleEngineName string) error {
+	return t.tx.Bucket(ruleEngineBucket).Delete([]byte(ruleEngineName))
+}
+
+func (t *boltTx) getConfig(id primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error) {
+	data := t.tx.Bucket(configBucket).Get(id[:])
+	if data == nil {
+		return nil, nil
+	}
+
+	var config ruleenginecore.RuleEngineConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (t *boltTx) putConfig(engineConfig *entities.EngineConfig) error {
+	data, err := json.Marshal(engineConfig.EngineCoreConfig)
+	if err != nil {
+		return err
+	}
+	return t.tx.Bucket(configBucket).Put(engineConfig.ID[:], data)
+}
+
+func (t *boltTx) deleteConfig(id primitive.ObjectID) error {
+	return t.tx.Bucket(configBucket).Delete(id[:])
+}
+
+func (t *boltTx) putShadowDisagreement(disagreement *entities.ShadowDisagreement) error {
+	bucket, err := t.tx.Bucket(shadowBucket).CreateBucketIfNotExists([]byte(disagreement.RuleEngine))
+	if err != nil {
+		return err
+	}
+
+	data, err := bson.Marshal(disagreement)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(disagreement.ID[:], data)
+}
+
+func (t *boltTx) listShadowDisagreements(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.ShadowDisagreement, error) {
+	disagreements := []*entities.ShadowDisagreement{}
+	bucket := t.tx.Bucket(shadowBucket).Bucket([]byte(ruleEngineName))
+	if bucket == nil {
+		return disagreements, nil
+	}
+
+	c := bucket.Cursor()
+	var data []byte
+	if before.IsZero() {
+		_, data = c.Last()
+	} else if key, _ := c.Seek(before[:]); key == nil {
+		_, data = c.Last()
+	} else {
+		_, data = c.Prev()
+	}
+
+	for ; data != nil && len(disagreements) < limit; _, data = c.Prev() {
+		var disagreement entities.ShadowDisagreement
+		if err := bson.Unmarshal(data, &disagreement); err != nil {
+			return nil, err
+		}
+		disagreements = append(disagreements, &disagreement)
+	}
+	return disagreements, nil
+}
+
+func (t *boltTx) deleteShadowDisagreements(ruleEngineName string) error {
+	err := t.tx.Bucket(shadowBucket).DeleteBucket([]byte(ruleEngineName))
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+	return err
+}
+
+func (t *boltTx) renameShadowDisagreements(ruleEngineName string, newRuleEngineName string) error {
+	return t.renameNested(shadowBucket, ruleEngineName, newRuleEngineName)
+}
+
+func (t *boltTx) renameAuditEvents(ruleEngineName string, newRuleEngineName string) error {
+	return t.renameNested(auditBucket, ruleEngineName, newRuleEngineName)
+}
+
+// renameNested moves records of RuleEngine nested bucket to bucket of new name, ruleEngine field of every record is updated
+func (t *boltTx) renameNested(parent []byte, ruleEngineName string, newRuleEngineName string) error {
+	bucket := t.tx.Bucket(parent).Bucket([]byte(ruleEngineName))
+	if bucket == nil {
+		return nil
+	}
+
+	newBucket, err := t.tx.Bucket(parent).CreateBucketIfNotExists([]byte(newRuleEngineName))
+	if err != nil {
+		return err
+	}
+
+	err = bucket.ForEach(func(key, data []byte) error {
+		var record bson.D
+		if err := bson.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		for i := range record {
+			if record[i].Key == "ruleEngine" {
+				record[i].Value = newRuleEngineName
+			}
+		}
+
+		renamed, err := bson.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return newBucket.Put(key, renamed)
+	})
+	if err != nil {
+		return err
+	}
+	return t.tx.Bucket(parent).DeleteBucket([]byte(ruleEngineName))
+}
+
+func (t *boltTx) putAuditEvent(event *entities.AuditEvent) error {
+	bucket, err := t.tx.Bucket(auditBucket).CreateBucketIfNotExists([]byte(event.RuleEngine))
+	if err != nil {
+		return err
+	}
+
+	data, err := bson.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(event.ID[:], data)
+}
+
+func (t *boltTx) listAuditEvents(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.AuditEvent, error) {
+	events := []*entities.AuditEvent{}
+	bucket := t.tx.Bucket(auditBucket).Bucket([]byte(ruleEngineName))
+	if bucket == nil {
+		return events, nil
+	}
+
+	c := bucket.Cursor()
+	var data []byte
+	if before.IsZero() {
+		_, data = c.Last()
+	} else if key, _ := c.Seek(before[:]); key == nil {
+		_, data = c.Last()
+	} else {
+		_, data = c.Prev()
+	}
+
+	for ; data != nil && len(events) < limit; _, data = c.Prev() {
+		var event entities.AuditEvent
+		if err := bson.Unmarshal(data, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, nil
+}
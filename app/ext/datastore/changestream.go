@@ -0,0 +1,113 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	// $changeStream stage is only supported on replica sets
+	errCodeChangeStreamNotSupported = 40573
+	errCodeChangeStreamHistoryLost  = 286
+	errCodeChangeStreamFatalError   = 280
+)
+
+type mongoChangeStream struct {
+	stream *mongo.ChangeStream
+}
+
+type changeEvent struct {
+	OperationType string               `bson:"operationType"`
+	FullDocument  *entities.RuleEngine `bson:"fullDocument"`
+}
+
+type workerState struct {
+	ID          string   `bson:"_id"`
+	ResumeToken bson.Raw `bson:"resumeToken"`
+	UpdateTime  int64    `bson:"updateTime"`
+}
+
+// WatchRuleEngines opens change stream on ruleengine collection, returns ErrChangeStreamNotSupported when deployment is not a replica set.
+func (s *mongoStore) WatchRuleEngines(ctx context.Context, resumeToken []byte) (ChangeStream, error) {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if len(resumeToken) != 0 {
+		opts.SetResumeAfter(bson.Raw(resumeToken))
+	}
+
+	stream, err := s.ruleEngineCollection.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		return nil, changeStreamError(err)
+	}
+	return &mongoChangeStream{stream: stream}, nil
+}
+
+func (cs *mongoChangeStream) Next(ctx context.Context) (*RuleEngineChange, error) {
+	if !cs.stream.Next(ctx) {
+		if err := cs.stream.Err(); err != nil {
+			return nil, changeStreamError(err)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("change stream closed")
+	}
+
+	var event changeEvent
+	if err := cs.stream.Decode(&event); err != nil {
+		return nil, err
+	}
+
+	if event.OperationType == "invalidate" {
+		return nil, ErrChangeStreamInvalidated
+	}
+
+	return &RuleEngineChange{RuleEngine: event.FullDocument, ResumeToken: cs.stream.ResumeToken()}, nil
+}
+
+func (cs *mongoChangeStream) Close(ctx context.Context) error {
+	return cs.stream.Close(ctx)
+}
+
+func (s *mongoStore) GetResumeToken(ctx context.Context, workerID string) ([]byte, *entities.Error) {
+	var state workerState
+	err := s.workerStateCollection.FindOne(ctx, bson.M{"_id": workerID}).Decode(&state)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		log.Logger.Error("Get worker state failed", zap.String("Error", err.Error()))
+		return nil, entities.NewError(entities.ErrCodeDatastoreFailed)
+	}
+	return state.ResumeToken, nil
+}
+
+func (s *mongoStore) SaveResumeToken(ctx context.Context, workerID string, resumeToken []byte) *entities.Error {
+	state := workerState{ID: workerID, ResumeToken: resumeToken, UpdateTime: time.Now().Unix()}
+	opts := options.Replace().SetUpsert(true)
+	if _, err := s.workerStateCollection.ReplaceOne(ctx, bson.M{"_id": workerID}, state, opts); err != nil {
+		log.Logger.Error("Save worker state failed", zap.String("Error", err.Error()))
+		return entities.NewError(entities.ErrCodeDatastoreFailed)
+	}
+	return nil
+}
+
+func changeStreamError(err error) error {
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		if serverErr.HasErrorCode(errCodeChangeStreamNotSupported) {
+			return ErrChangeStreamNotSupported
+		}
+		if serverErr.HasErrorCode(errCodeChangeStreamHistoryLost) || serverErr.HasErrorCode(errCodeChangeStreamFatalError) {
+			return ErrResumeTokenExpired
+		}
+	}
+	return err
+}
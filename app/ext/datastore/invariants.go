@@ -0,0 +1,467 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// Tag state transitions shared by every datastore and every caller i.e. control plane APIs and scheduler,
+// so that invariants are enforced alike. Transitions mutate given RuleEngine, caller persists it in same transaction.
+
+// enableTag enables tag, reports whether RuleEngine is changed
+func enableTag(ruleEngine *entities.RuleEngine, tag string) (bool, *entities.Error) {
+	t, ok := ruleEngine.Tags[tag]
+	if !ok {
+		return false, entities.NewError(entities.ErrCodeTagNotFound)
+	}
+	if t.IsEnable {
+		return false, nil
+	}
+
+	t.IsEnable = true
+	return true, nil
+}
+
+// disableTag disables tag which is neither default nor referenced, reports whether RuleEngine is changed
+func disableTag(ruleEngine *entities.RuleEngine, tag string) (bool, *entities.Error) {
+	t, ok := ruleEngine.Tags[tag]
+	if !ok {
+		return false, entities.NewError(entities.ErrCodeTagNotFound)
+	}
+	if !t.IsEnable {
+		return false, nil
+	}
+
+	if ruleEngine.DefaultTag == tag || isReferenced(ruleEngine, tag) {
+		return false, entities.NewError(entities.ErrCodeTagDisableNotAllowed)
+	}
+
+	t.IsEnable = false
+	return true, nil
+}
+
+// checkNewTag verifies that tag could be added to RuleEngine(nil as not existing), i.e. it is neither a tag nor an alias
+func checkNewTag(ruleEngine *entities.RuleEngine, tag string) *entities.Error {
+	if ruleEngine == nil {
+		return nil
+	}
+	if _, ok := ruleEngine.Tags[tag]; ok {
+		return entities.NewError(entities.ErrCodeTagAlreadyExist)
+	}
+	if _, ok := ruleEngine.Aliases[tag]; ok {
+		return entities.NewError(entities.ErrCodeAliasConflict)
+	}
+	return nil
+}
+
+// addTag adds disabled tag of stored config to RuleEngine, RuleEngine is created in case it is nil
+func addTag(ruleEngine *entities.RuleEngine, ruleEngineName string, tag string, engineConfigID primitive.ObjectID, configDigest string) *entities.RuleEngine {
+	if ruleEngine == nil {
+		ruleEngine = &entities.RuleEngine{
+			Name:        ruleEngineName,
+			DefaultTag:  "",
+			Tags:        map[string]*entities.Tag{},
+			Incarnation: primitive.NewObjectID(),
+		}
+	}
+
+	if ruleEngine.Tags == nil {
+		ruleEngine.Tags = map[string]*entities.Tag{}
+	}
+
+	ruleEngine.Tags[tag] = &entities.Tag{
+		Name:           tag,
+		EngineConfigID: engineConfigID,
+		IsEnable:       false,
+		Digest:         configDigest,
+	}
+	ruleEngine.LastUpdateTime = time.Now().Unix()
+	return ruleEngine
+}
+
+// deleteTag removes tag which is neither enabled nor referenced, removed tag is returned so that caller deletes its config.
+// deleted tag is kept in default tag history, rollback to it is reported as previous default tag deleted.
+func deleteTag(ruleEngine *entities.RuleEngine, tag string) (*entities.Tag, *entities.Error) {
+	t, ok := ruleEngine.Tags[tag]
+	if !ok {
+		return nil, entities.NewError(entities.ErrCodeTagNotFound)
+	}
+	if t.IsEnable || isReferenced(ruleEngine, tag) {
+		return nil, entities.NewError(entities.ErrCodeTagDeleteNotAllowed)
+	}
+
+	delete(ruleEngine.Tags, tag)
+	return t, nil
+}
+
+// fillDigests sets digest of tags stored before digests, i.e. with empty digest, from their stored config.
+// reports whether RuleEngine is changed.
+func fillDigests(ruleEngine *entities.RuleEngine, getConfig func(primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error)) (bool, error) {
+	changed := false
+	for _, t := range ruleEngine.Tags {
+		if t.Digest != "" {
+			continue
+		}
+
+		config, err := getConfig(t.EngineConfigID)
+		if err != nil {
+			return false, err
+		}
+		if config == nil {
+			return false, fmt.Errorf("config %v of tag %v not found", t.EngineConfigID.Hex(), t.Name)
+		}
+		if t.Digest, err = digest.Of(config); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// renameTag renames tag along with every reference to it, i.e. default, aliases, traffic split, shadow,
+// default tag history and remembered previous default. config, enable state and schedule are kept as is.
+func renameTag(ruleEngine *entities.RuleEngine, tag string, newTag string) *entities.Error {
+	t, ok := ruleEngine.Tags[tag]
+	if !ok {
+		return entities.NewError(entities.ErrCodeTagNotFound)
+	}
+	if err := checkNewTag(ruleEngine, newTag); err != nil {
+		return err
+	}
+
+	delete(ruleEngine.Tags, tag)
+	t.Name = newTag
+	ruleEngine.Tags[newTag] = t
+
+	if ruleEngine.DefaultTag == tag {
+		ruleEngine.DefaultTag = newTag
+	}
+	if ruleEngine.ShadowTag == tag {
+		ruleEngine.ShadowTag = newTag
+	}
+	for alias, aliased := range ruleEngine.Aliases {
+		if aliased == tag {
+			ruleEngine.Aliases[alias] = newTag
+		}
+	}
+	for _, tw := range ruleEngine.TrafficSplit {
+		if tw.Tag == tag {
+			tw.Tag = newTag
+		}
+	}
+	for i, replaced := range ruleEngine.DefaultTagHistory {
+		if replaced == tag {
+			ruleEngine.DefaultTagHistory[i] = newTag
+		}
+	}
+	for _, other := range ruleEngine.Tags {
+		if other.PreviousDefaultTag == tag {
+			other.PreviousDefaultTag = newTag
+		}
+	}
+
+	ruleEngine.LastUpdateTime = time.Now().Unix()
+	return nil
+}
+
+// ruleEngineOf spec, config of every tag is stored by caller with engineConfigIDs keyed by tag.
+// replaced RuleEngine(nil as not existing) contributes default tag history, so that replaced default could be rolled back.
+// Schedules are not part of spec, hence RuleEngine has none.
+func ruleEngineOf(spec *entities.RuleEngineSpec, replaced *entities.RuleEngine, engineConfigIDs map[string]primitive.ObjectID) (*entities.RuleEngine, *entities.Error) {
+	var ruleEngine *entities.RuleEngine
+	for tag, tagSpec := range spec.Tags {
+		configDigest, err := digest.Of(tagSpec.Config)
+		if err != nil {
+			log.Logger.Error("RuleEngineConfig digest failed", zap.String("Error", err.Error()))
+			return nil, entities.NewError(entities.ErrCodeDatastoreFailed)
+		}
+		ruleEngine = addTag(ruleEngine, spec.Name, tag, engineConfigIDs[tag], configDigest)
+		if tagSpec.IsEnable {
+			enableTag(ruleEngine, tag)
+		}
+	}
+	if ruleEngine == nil {
+		return nil, entities.NewError(entities.ErrCodeTagNotFound)
+	}
+
+	if replaced != nil {
+		// version keeps increasing within incarnation, so that replaced state is never considered newer
+		ruleEngine.Version = replaced.Version
+		ruleEngine.Incarnation = replaced.Incarnation
+		ruleEngine.DefaultTag = replaced.DefaultTag
+		ruleEngine.DefaultTagHistory = append([]string{}, replaced.DefaultTagHistory...)
+	}
+	if spec.DefaultTag != "" {
+		if err := setDefaultTag(ruleEngine, spec.DefaultTag); err != nil {
+			return nil, err
+		}
+	} else if ruleEngine.DefaultTag != "" {
+		removeDefaultTag(ruleEngine)
+	}
+
+	for alias, tag := range spec.Aliases {
+		if err := setAlias(ruleEngine, alias, tag); err != nil {
+			return nil, entities.NewErrorWithMsg(err.ErrCode, "alias:"+alias)
+		}
+	}
+
+	if len(spec.TrafficSplit) != 0 {
+		if err := validateTrafficSplit(ruleEngine, spec.TrafficSplit); err != nil {
+			return nil, err
+		}
+		for _, tw := range spec.TrafficSplit {
+			ruleEngine.TrafficSplit = append(ruleEngine.TrafficSplit, &entities.TagWeight{Tag: tw.Tag, Weight: tw.Weight})
+		}
+	}
+
+	if err := setShadowTag(ruleEngine, spec.ShadowTag); err != nil {
+		return nil, err
+	}
+	return ruleEngine, nil
+}
+
+// setAlias points alias, which must not be a tag name, to enabled tag
+func setAlias(ruleEngine *entities.RuleEngine, alias string, tag string) *entities.Error {
+	if _, ok := ruleEngine.Tags[alias]; ok {
+		return entities.NewError(entities.ErrCodeAliasConflict)
+	}
+	if t, ok := ruleEngine.Tags[tag]; !ok || !t.IsEnable {
+		return entities.NewError(entities.ErrCodeAliasTagMustBeEnabled)
+	}
+
+	if ruleEngine.Aliases == nil {
+		ruleEngine.Aliases = map[string]string{}
+	}
+	ruleEngine.Aliases[alias] = tag
+	return nil
+}
+
+// setShadowTag sets enabled tag as shadow tag, empty tag unsets it
+func setShadowTag(ruleEngine *entities.RuleEngine, tag string) *entities.Error {
+	if tag != "" {
+		if t, ok := ruleEngine.Tags[tag]; !ok || !t.IsEnable {
+			return entities.NewError(entities.ErrCodeShadowTagMustBeEnabled)
+		}
+	}
+	ruleEngine.ShadowTag = tag
+	return nil
+}
+
+// specError is err of RuleEngine spec, i.e. RuleEngine name is prefixed to detail
+func specError(ruleEngineName string, err *entities.Error) *entities.Error {
+	return entities.NewErrorWithMsg(err.ErrCode, strings.TrimSpace("ruleEngine:"+ruleEngineName+" "+err.OtherMsg))
+}
+
+// number of replaced default tags remembered for rollback
+const maxDefaultTagHistory = 10
+
+// setDefaultTag sets enabled tag as default, replaced default is remembered for rollback
+func setDefaultTag(ruleEngine *entities.RuleEngine, tag string) *entities.Error {
+	t, ok := ruleEngine.Tags[tag]
+	if !ok || !t.IsEnable {
+		return entities.NewError(entities.ErrCodeDefaultTagExistAndMustBeEnabled)
+	}
+
+	if ruleEngine.DefaultTag != tag {
+		pushDefaultTagHistory(ruleEngine)
+	}
+	ruleEngine.DefaultTag = tag
+	return nil
+}
+
+// removeDefaultTag unsets default, removed default is remembered for rollback
+func removeDefaultTag(ruleEngine *entities.RuleEngine) {
+	pushDefaultTagHistory(ruleEngine)
+	ruleEngine.DefaultTag = ""
+}
+
+// rollbackDefaultTag restores most recently replaced default tag, re-enabling it if needed.
+// restored tag is forgotten, i.e. consecutive rollbacks walk back the history. Rollback to a deleted tag fails,
+// history is kept as is so that default is set explicitly instead.
+func rollbackDefaultTag(ruleEngine *entities.RuleEngine) (string, *entities.Error) {
+	tag := previousDefaultTag(ruleEngine)
+	if tag == "" {
+		return "", entities.NewError(entities.ErrCodeNoPreviousDefaultTag)
+	}
+	if _, ok := ruleEngine.Tags[tag]; !ok {
+		return "", entities.NewErrorWithMsg(entities.ErrCodePreviousDefaultTagDeleted, "tag:"+tag)
+	}
+
+	// neither restored tag nor replaced default is remembered
+	remaining := append([]string{}, ruleEngine.DefaultTagHistory[:len(ruleEngine.DefaultTagHistory)-1]...)
+
+	if _, err := enableTag(ruleEngine, tag); err != nil {
+		return "", err
+	}
+	if err := setDefaultTag(ruleEngine, tag); err != nil {
+		return "", err
+	}
+
+	ruleEngine.DefaultTagHistory = remaining
+	return tag, nil
+}
+
+// previousDefaultTag is rollback target, i.e. most recent history entry, empty in case of no history
+func previousDefaultTag(ruleEngine *entities.RuleEngine) string {
+	if len(ruleEngine.DefaultTagHistory) == 0 {
+		return ""
+	}
+	return ruleEngine.DefaultTagHistory[len(ruleEngine.DefaultTagHistory)-1]
+}
+
+func pushDefaultTagHistory(ruleEngine *entities.RuleEngine) {
+	if ruleEngine.DefaultTag == "" {
+		return
+	}
+
+	ruleEngine.DefaultTagHistory = append(ruleEngine.DefaultTagHistory, ruleEngine.DefaultTag)
+	if len(ruleEngine.DefaultTagHistory) > maxDefaultTagHistory {
+		ruleEngine.DefaultTagHistory = ruleEngine.DefaultTagHistory[len(ruleEngine.DefaultTagHistory)-maxDefaultTagHistory:]
+	}
+}
+
+// setTagSchedule schedules activation and expiry of tag, 0 as not scheduled
+func setTagSchedule(ruleEngine *entities.RuleEngine, tag string, activateAt int64, expireAt int64) *entities.Error {
+	t, ok := ruleEngine.Tags[tag]
+	if !ok {
+		return entities.NewError(entities.ErrCodeTagNotFound)
+	}
+
+	// previous default of already activated tag is kept for its expiry
+	if activateAt != 0 {
+		t.PreviousDefaultTag = ""
+	}
+	t.ActivateAt, t.ExpireAt = activateAt, expireAt
+	ruleEngine.NextScheduleTime = nextScheduleTime(ruleEngine)
+	return nil
+}
+
+type scheduleEvent struct {
+	time   int64
+	tag    string
+	expiry bool
+}
+
+// applySchedule applies activations and expiries due by now in time order, reports whether RuleEngine is changed
+// along with audit event of every applied activation and expiry.
+//
+// Activation enables tag and sets it as default, replaced default is remembered on tag.
+// Expiry reverts default to remembered tag, or else to most recent tag of default tag history, and disables tag
+// unless tag is still referenced by alias, traffic split or shadow. In case there is nothing to revert to, expired tag
+// is kept as default and failure is audited. At same time, expiry is applied before activation
+// so that handover from one scheduled tag to another reverts to the right default later.
+func applySchedule(ctx context.Context, ruleEngine *entities.RuleEngine, now int64) (bool, []*entities.AuditEvent) {
+	events := []*scheduleEvent{}
+	for name, t := range ruleEngine.Tags {
+		if t.ActivateAt != 0 && t.ActivateAt <= now {
+			events = append(events, &scheduleEvent{time: t.ActivateAt, tag: name})
+		}
+		if t.ExpireAt != 0 && t.ExpireAt <= now {
+			events = append(events, &scheduleEvent{time: t.ExpireAt, tag: name, expiry: true})
+		}
+	}
+	if len(events) == 0 {
+		// stale in case scheduled tag is deleted
+		next := nextScheduleTime(ruleEngine)
+		if next == ruleEngine.NextScheduleTime {
+			return false, nil
+		}
+		ruleEngine.NextScheduleTime = next
+		return true, nil
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].time != events[j].time {
+			return events[i].time < events[j].time
+		}
+		if events[i].expiry != events[j].expiry {
+			return events[i].expiry
+		}
+		return events[i].tag < events[j].tag
+	})
+
+	auditEvents := []*entities.AuditEvent{}
+	for _, event := range events {
+		t := ruleEngine.Tags[event.tag]
+		before := auditStateOf(ruleEngine, event.tag)
+		if !event.expiry {
+			enableTag(ruleEngine, event.tag)
+			previous := ruleEngine.DefaultTag
+			setDefaultTag(ruleEngine, event.tag)
+			if previous != event.tag {
+				t.PreviousDefaultTag = previous
+			}
+			t.ActivateAt = 0
+			log.Logger.Info("Scheduled tag activated", zap.String("RuleEngine", ruleEngine.Name), zap.String("Tag", event.tag))
+			auditEvents = append(auditEvents, newAuditEvent(ctx, entities.AuditOpScheduledActivation, ruleEngine.Name, event.tag, before, auditStateOf(ruleEngine, event.tag)))
+			continue
+		}
+
+		detail := ""
+		if ruleEngine.DefaultTag == event.tag && revertDefaultTag(ruleEngine, event.tag, t.PreviousDefaultTag) == "" {
+			detail = "expiry failed, no previous default tag to revert to, tag is kept as default"
+			log.Logger.Error("Scheduled expiry failed, no previous default tag to revert to", zap.String("RuleEngine", ruleEngine.Name), zap.String("Tag", event.tag))
+		} else if _, err := disableTag(ruleEngine, event.tag); err != nil {
+			log.Logger.Warn("Expired tag is still referenced, kept enabled", zap.String("RuleEngine", ruleEngine.Name), zap.String("Tag", event.tag))
+		}
+		t.ExpireAt = 0
+		t.PreviousDefaultTag = ""
+		log.Logger.Info("Scheduled tag expired", zap.String("RuleEngine", ruleEngine.Name), zap.String("Tag", event.tag), zap.String("DefaultTag", ruleEngine.DefaultTag))
+		auditEvent := newAuditEvent(ctx, entities.AuditOpScheduledExpiry, ruleEngine.Name, event.tag, before, auditStateOf(ruleEngine, event.tag))
+		auditEvent.Detail = detail
+		auditEvents = append(auditEvents, auditEvent)
+	}
+
+	ruleEngine.NextScheduleTime = nextScheduleTime(ruleEngine)
+	return true, auditEvents
+}
+
+// revertDefaultTag replaces expired default by tag replaced on activation, or else by most recent existing tag of
+// default tag history, re-enabling it if needed. returns restored tag, empty in case there is nothing to revert to.
+func revertDefaultTag(ruleEngine *entities.RuleEngine, expired string, previous string) string {
+	if _, ok := ruleEngine.Tags[previous]; ok && previous != expired {
+		enableTag(ruleEngine, previous)
+		if setDefaultTag(ruleEngine, previous) == nil {
+			return previous
+		}
+	}
+
+	for i := len(ruleEngine.DefaultTagHistory) - 1; i >= 0; i-- {
+		tag := ruleEngine.DefaultTagHistory[i]
+		if _, ok := ruleEngine.Tags[tag]; !ok || tag == expired {
+			continue
+		}
+
+		// restored entry is forgotten, same as rollback
+		ruleEngine.DefaultTagHistory = append([]string{}, ruleEngine.DefaultTagHistory[:i]...)
+		enableTag(ruleEngine, tag)
+		if setDefaultTag(ruleEngine, tag) == nil {
+			log.Logger.Warn("Scheduled expiry reverted default to history", zap.String("RuleEngine", ruleEngine.Name), zap.String("Tag", expired), zap.String("DefaultTag", tag))
+			return tag
+		}
+	}
+	return ""
+}
+
+// nextScheduleTime is earliest pending activation or expiry, 0 if nothing is scheduled
+func nextScheduleTime(ruleEngine *entities.RuleEngine) int64 {
+	next := int64(0)
+	for _, t := range ruleEngine.Tags {
+		for _, at := range []int64{t.ActivateAt, t.ExpireAt} {
+			if at != 0 && (next == 0 || at < next) {
+				next = at
+			}
+		}
+	}
+	return next
+}
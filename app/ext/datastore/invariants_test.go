@@ -0,0 +1,608 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// testRuleEngine has default v1, v2 aliased as stable, v3 as shadow, v1 and v4 in traffic split, disabled v5
+// and default tag history of v5 then v2. Every call returns a fresh RuleEngine.
+func testRuleEngine() *entities.RuleEngine {
+	log.Logger = zap.NewNop()
+	ruleEngine := &entities.RuleEngine{
+		Name:              "shop",
+		DefaultTag:        "v1",
+		Tags:              map[string]*entities.Tag{},
+		Aliases:           map[string]string{"stable": "v2"},
+		TrafficSplit:      []*entities.TagWeight{{Tag: "v1", Weight: 50}, {Tag: "v4", Weight: 50}},
+		ShadowTag:         "v3",
+		DefaultTagHistory: []string{"v5", "v2"},
+	}
+	for _, tag := range []string{"v1", "v2", "v3", "v4", "v5"} {
+		ruleEngine.Tags[tag] = &entities.Tag{Name: tag, EngineConfigID: primitive.NewObjectID(), IsEnable: tag != "v5", Digest: "sha256:" + tag}
+	}
+	return ruleEngine
+}
+
+func errCodeOf(err *entities.Error) uint {
+	if err == nil {
+		return 0
+	}
+	return err.ErrCode
+}
+
+func TestEnableTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		tag         string
+		wantChanged bool
+		wantErr     uint
+	}{
+		{"disabled tag", "v5", true, 0},
+		{"enabled tag", "v1", false, 0},
+		{"unknown tag", "v9", false, entities.ErrCodeTagNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			changed, err := enableTag(ruleEngine, tt.tag)
+			if changed != tt.wantChanged || errCodeOf(err) != tt.wantErr {
+				t.Fatalf("enableTag() = %v, %v, want %v, errCode %v", changed, err, tt.wantChanged, tt.wantErr)
+			}
+			if tt.wantErr == 0 && !ruleEngine.Tags[tt.tag].IsEnable {
+				t.Errorf("tag %v not enabled", tt.tag)
+			}
+		})
+	}
+}
+
+func TestDisableTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		tag         string
+		wantChanged bool
+		wantErr     uint
+	}{
+		{"default tag", "v1", false, entities.ErrCodeTagDisableNotAllowed},
+		{"aliased tag", "v2", false, entities.ErrCodeTagDisableNotAllowed},
+		{"shadow tag", "v3", false, entities.ErrCodeTagDisableNotAllowed},
+		{"traffic split tag", "v4", false, entities.ErrCodeTagDisableNotAllowed},
+		{"disabled tag", "v5", false, 0},
+		{"unreferenced tag", "v6", true, 0},
+		{"unknown tag", "v9", false, entities.ErrCodeTagNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			ruleEngine.Tags["v6"] = &entities.Tag{Name: "v6", IsEnable: true}
+
+			changed, err := disableTag(ruleEngine, tt.tag)
+			if changed != tt.wantChanged || errCodeOf(err) != tt.wantErr {
+				t.Fatalf("disableTag() = %v, %v, want %v, errCode %v", changed, err, tt.wantChanged, tt.wantErr)
+			}
+			if tag, ok := ruleEngine.Tags[tt.tag]; ok && tag.IsEnable == (tt.wantErr == 0) {
+				t.Errorf("tag %v enable state %v", tt.tag, tag.IsEnable)
+			}
+		})
+	}
+}
+
+func TestDeleteTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		wantErr uint
+	}{
+		{"disabled tag", "v5", 0},
+		{"enabled tag", "v4", entities.ErrCodeTagDeleteNotAllowed},
+		{"unknown tag", "v9", entities.ErrCodeTagNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			deleted, err := deleteTag(ruleEngine, tt.tag)
+			if errCodeOf(err) != tt.wantErr {
+				t.Fatalf("deleteTag() error = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr == 0 {
+				if _, ok := ruleEngine.Tags[tt.tag]; ok || deleted == nil || deleted.Name != tt.tag {
+					t.Errorf("tag %v not deleted, returned %+v", tt.tag, deleted)
+				}
+			}
+			// deleted tag stays in history
+			if want := []string{"v5", "v2"}; !reflect.DeepEqual(ruleEngine.DefaultTagHistory, want) {
+				t.Errorf("history = %v, want %v", ruleEngine.DefaultTagHistory, want)
+			}
+		})
+	}
+}
+
+func TestSetDefaultTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		tag         string
+		wantErr     uint
+		wantDefault string
+		wantHistory []string
+	}{
+		{"enabled tag", "v4", 0, "v4", []string{"v5", "v2", "v1"}},
+		{"current default", "v1", 0, "v1", []string{"v5", "v2"}},
+		{"disabled tag", "v5", entities.ErrCodeDefaultTagExistAndMustBeEnabled, "v1", []string{"v5", "v2"}},
+		{"unknown tag", "v9", entities.ErrCodeDefaultTagExistAndMustBeEnabled, "v1", []string{"v5", "v2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			if err := setDefaultTag(ruleEngine, tt.tag); errCodeOf(err) != tt.wantErr {
+				t.Fatalf("setDefaultTag() = %v, want errCode %v", err, tt.wantErr)
+			}
+			if ruleEngine.DefaultTag != tt.wantDefault || !reflect.DeepEqual(ruleEngine.DefaultTagHistory, tt.wantHistory) {
+				t.Errorf("default %v, history %v, want %v, %v", ruleEngine.DefaultTag, ruleEngine.DefaultTagHistory, tt.wantDefault, tt.wantHistory)
+			}
+		})
+	}
+}
+
+func TestDefaultTagHistoryIsBounded(t *testing.T) {
+	ruleEngine := testRuleEngine()
+	for i := 0; i < maxDefaultTagHistory*2; i++ {
+		tag := []string{"v2", "v4"}[i%2]
+		if err := setDefaultTag(ruleEngine, tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removeDefaultTag(ruleEngine)
+
+	history := ruleEngine.DefaultTagHistory
+	if ruleEngine.DefaultTag != "" || len(history) != maxDefaultTagHistory || history[len(history)-1] != "v4" {
+		t.Errorf("default %v, history %v", ruleEngine.DefaultTag, history)
+	}
+}
+
+func TestRollbackDefaultTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		history     []string
+		deleted     string
+		wantTag     string
+		wantErr     uint
+		wantHistory []string
+	}{
+		{"most recent", []string{"v5", "v2"}, "", "v2", 0, []string{"v5"}},
+		{"disabled tag re-enabled", []string{"v2", "v5"}, "", "v5", 0, []string{"v2"}},
+		{"most recent tag deleted", []string{"v2", "v5"}, "v5", "", entities.ErrCodePreviousDefaultTagDeleted, []string{"v2", "v5"}},
+		{"older tag deleted", []string{"v5", "v2"}, "v5", "v2", 0, []string{"v5"}},
+		{"no history", nil, "", "", entities.ErrCodeNoPreviousDefaultTag, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			ruleEngine.DefaultTagHistory = tt.history
+			delete(ruleEngine.Tags, tt.deleted)
+
+			tag, err := rollbackDefaultTag(ruleEngine)
+			if tag != tt.wantTag || errCodeOf(err) != tt.wantErr {
+				t.Fatalf("rollbackDefaultTag() = %v, %v, want %v, errCode %v", tag, err, tt.wantTag, tt.wantErr)
+			}
+			if !reflect.DeepEqual(ruleEngine.DefaultTagHistory, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", ruleEngine.DefaultTagHistory, tt.wantHistory)
+			}
+			wantDefault := tt.wantTag
+			if tt.wantErr != 0 {
+				wantDefault = "v1"
+			}
+			if ruleEngine.DefaultTag != wantDefault || !ruleEngine.Tags[wantDefault].IsEnable {
+				t.Errorf("default %v, want %v as enabled", ruleEngine.DefaultTag, wantDefault)
+			}
+		})
+	}
+}
+
+func TestSetTagSchedule(t *testing.T) {
+	ruleEngine := testRuleEngine()
+	ruleEngine.Tags["v4"].PreviousDefaultTag = "v2"
+
+	if err := setTagSchedule(ruleEngine, "v9", 100, 0); errCodeOf(err) != entities.ErrCodeTagNotFound {
+		t.Errorf("setTagSchedule() of unknown tag = %v", err)
+	}
+	if err := setTagSchedule(ruleEngine, "v5", 200, 300); err != nil {
+		t.Fatal(err)
+	}
+	if err := setTagSchedule(ruleEngine, "v4", 0, 150); err != nil {
+		t.Fatal(err)
+	}
+
+	// expiry only keeps previous default of already activated tag
+	if ruleEngine.Tags["v4"].PreviousDefaultTag != "v2" || ruleEngine.NextScheduleTime != 150 {
+		t.Errorf("previous default %v, next schedule %v", ruleEngine.Tags["v4"].PreviousDefaultTag, ruleEngine.NextScheduleTime)
+	}
+
+	if err := setTagSchedule(ruleEngine, "v4", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if ruleEngine.NextScheduleTime != 200 {
+		t.Errorf("next schedule = %v, want 200", ruleEngine.NextScheduleTime)
+	}
+}
+
+func TestApplySchedule(t *testing.T) {
+	tests := []struct {
+		name        string
+		setup       func(*entities.RuleEngine)
+		now         int64
+		wantChanged bool
+		wantDefault string
+		wantEnabled map[string]bool
+		wantOps     []string
+		wantDetail  bool
+		wantNext    int64
+	}{
+		{
+			name:        "nothing due",
+			setup:       func(r *entities.RuleEngine) { r.Tags["v5"].ActivateAt = 200; r.NextScheduleTime = 200 },
+			now:         100,
+			wantDefault: "v1",
+			wantNext:    200,
+		},
+		{
+			name:        "stale next schedule time",
+			setup:       func(r *entities.RuleEngine) { r.NextScheduleTime = 50 },
+			now:         100,
+			wantChanged: true,
+			wantDefault: "v1",
+		},
+		{
+			name:        "activation",
+			setup:       func(r *entities.RuleEngine) { r.Tags["v5"].ActivateAt = 100; r.Tags["v5"].ExpireAt = 200 },
+			now:         100,
+			wantChanged: true,
+			wantDefault: "v5",
+			wantEnabled: map[string]bool{"v5": true},
+			wantOps:     []string{entities.AuditOpScheduledActivation},
+			wantNext:    200,
+		},
+		{
+			name:        "activation and expiry reverts to replaced default",
+			setup:       func(r *entities.RuleEngine) { r.Tags["v5"].ActivateAt = 100; r.Tags["v5"].ExpireAt = 200 },
+			now:         200,
+			wantChanged: true,
+			wantDefault: "v1",
+			wantEnabled: map[string]bool{"v5": false},
+			wantOps:     []string{entities.AuditOpScheduledActivation, entities.AuditOpScheduledExpiry},
+		},
+		{
+			name: "expiry falls back to default tag history",
+			setup: func(r *entities.RuleEngine) {
+				r.Tags["v6"] = &entities.Tag{Name: "v6", IsEnable: true, ExpireAt: 100, PreviousDefaultTag: "v9"}
+				r.DefaultTag = "v6"
+				r.DefaultTagHistory = []string{"v5", "v9"}
+			},
+			now:         100,
+			wantChanged: true,
+			wantDefault: "v5",
+			wantEnabled: map[string]bool{"v5": true, "v6": false},
+			wantOps:     []string{entities.AuditOpScheduledExpiry},
+		},
+		{
+			name: "expiry without revert target keeps default",
+			setup: func(r *entities.RuleEngine) {
+				r.Tags["v6"] = &entities.Tag{Name: "v6", IsEnable: true, ExpireAt: 100}
+				r.DefaultTag = "v6"
+				r.DefaultTagHistory = nil
+			},
+			now:         100,
+			wantChanged: true,
+			wantDefault: "v6",
+			wantEnabled: map[string]bool{"v6": true},
+			wantOps:     []string{entities.AuditOpScheduledExpiry},
+			wantDetail:  true,
+		},
+		{
+			name:        "expiry of referenced tag keeps it enabled",
+			setup:       func(r *entities.RuleEngine) { r.Tags["v2"].ExpireAt = 100 },
+			now:         100,
+			wantChanged: true,
+			wantDefault: "v1",
+			wantEnabled: map[string]bool{"v2": true},
+			wantOps:     []string{entities.AuditOpScheduledExpiry},
+		},
+		{
+			name: "handover expires before activation at same time",
+			setup: func(r *entities.RuleEngine) {
+				r.Tags["v6"] = &entities.Tag{Name: "v6", IsEnable: true, ExpireAt: 100, PreviousDefaultTag: "v1"}
+				r.DefaultTag = "v6"
+				r.Tags["v5"].ActivateAt = 100
+			},
+			now:         100,
+			wantChanged: true,
+			wantDefault: "v5",
+			wantEnabled: map[string]bool{"v5": true, "v6": false},
+			wantOps:     []string{entities.AuditOpScheduledExpiry, entities.AuditOpScheduledActivation},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			tt.setup(ruleEngine)
+
+			changed, events := applySchedule(context.Background(), ruleEngine, tt.now)
+			if changed != tt.wantChanged {
+				t.Fatalf("applySchedule() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if ruleEngine.DefaultTag != tt.wantDefault {
+				t.Errorf("default = %v, want %v", ruleEngine.DefaultTag, tt.wantDefault)
+			}
+			for tag, enabled := range tt.wantEnabled {
+				if ruleEngine.Tags[tag].IsEnable != enabled {
+					t.Errorf("tag %v enabled = %v, want %v", tag, !enabled, enabled)
+				}
+			}
+			ops := []string{}
+			for _, event := range events {
+				ops = append(ops, event.Operation)
+				if event.Operation == entities.AuditOpScheduledExpiry && (event.Detail != "") != tt.wantDetail {
+					t.Errorf("expiry detail = %q", event.Detail)
+				}
+			}
+			if !reflect.DeepEqual(ops, append([]string{}, tt.wantOps...)) {
+				t.Errorf("audited %v, want %v", ops, tt.wantOps)
+			}
+			if ruleEngine.NextScheduleTime != tt.wantNext {
+				t.Errorf("next schedule = %v, want %v", ruleEngine.NextScheduleTime, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestAddTag(t *testing.T) {
+	configID := primitive.NewObjectID()
+	ruleEngine := addTag(nil, "shop", "v1", configID, "sha256:v1")
+	if ruleEngine.Name != "shop" || ruleEngine.DefaultTag != "" {
+		t.Fatalf("unexpected RuleEngine %+v", ruleEngine)
+	}
+	if tag := ruleEngine.Tags["v1"]; tag == nil || tag.IsEnable || tag.EngineConfigID != configID || tag.Digest != "sha256:v1" {
+		t.Errorf("unexpected tag %+v", tag)
+	}
+
+	if same := addTag(ruleEngine, "shop", "v2", primitive.NewObjectID(), "sha256:v2"); same != ruleEngine || len(ruleEngine.Tags) != 2 {
+		t.Errorf("tag not added to existing RuleEngine, tags %v", ruleEngine.Tags)
+	}
+}
+
+func TestFillDigests(t *testing.T) {
+	config := testConfig(t)
+	configDigest, err := digest.Of(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		getConfig   func(primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error)
+		wantChanged bool
+		wantErr     bool
+	}{
+		{"config found", func(primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error) { return config, nil }, true, false},
+		{"config not found", func(primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error) { return nil, nil }, false, true},
+		{"read failed", func(primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error) { return nil, errors.New("failed") }, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			ruleEngine.Tags["v5"].Digest = ""
+
+			changed, err := fillDigests(ruleEngine, tt.getConfig)
+			if changed != tt.wantChanged || (err != nil) != tt.wantErr {
+				t.Fatalf("fillDigests() = %v, %v, want %v, error %v", changed, err, tt.wantChanged, tt.wantErr)
+			}
+			if !tt.wantErr && ruleEngine.Tags["v5"].Digest != configDigest {
+				t.Errorf("digest = %v, want %v", ruleEngine.Tags["v5"].Digest, configDigest)
+			}
+			if ruleEngine.Tags["v1"].Digest != "sha256:v1" {
+				t.Errorf("existing digest changed to %v", ruleEngine.Tags["v1"].Digest)
+			}
+		})
+	}
+}
+
+func TestSetAlias(t *testing.T) {
+	tests := []struct {
+		name    string
+		alias   string
+		tag     string
+		wantErr uint
+	}{
+		{"new alias", "canary", "v4", 0},
+		{"repoint alias", "stable", "v1", 0},
+		{"alias as tag name", "v1", "v2", entities.ErrCodeAliasConflict},
+		{"disabled tag", "canary", "v5", entities.ErrCodeAliasTagMustBeEnabled},
+		{"unknown tag", "canary", "v9", entities.ErrCodeAliasTagMustBeEnabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			if err := setAlias(ruleEngine, tt.alias, tt.tag); errCodeOf(err) != tt.wantErr {
+				t.Fatalf("setAlias() = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr == 0 && ruleEngine.Aliases[tt.alias] != tt.tag {
+				t.Errorf("aliases = %v", ruleEngine.Aliases)
+			}
+		})
+	}
+}
+
+func TestSetShadowTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		wantErr uint
+	}{
+		{"enabled tag", "v4", 0},
+		{"unset", "", 0},
+		{"disabled tag", "v5", entities.ErrCodeShadowTagMustBeEnabled},
+		{"unknown tag", "v9", entities.ErrCodeShadowTagMustBeEnabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			if err := setShadowTag(ruleEngine, tt.tag); errCodeOf(err) != tt.wantErr {
+				t.Fatalf("setShadowTag() = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr == 0 && ruleEngine.ShadowTag != tt.tag {
+				t.Errorf("shadow tag = %v, want %v", ruleEngine.ShadowTag, tt.tag)
+			}
+		})
+	}
+}
+
+func TestCheckNewTag(t *testing.T) {
+	tests := []struct {
+		name       string
+		ruleEngine *entities.RuleEngine
+		tag        string
+		wantErr    uint
+	}{
+		{"new RuleEngine", nil, "v1", 0},
+		{"new tag", testRuleEngine(), "v9", 0},
+		{"existing tag", testRuleEngine(), "v1", entities.ErrCodeTagAlreadyExist},
+		{"alias name", testRuleEngine(), "stable", entities.ErrCodeAliasConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkNewTag(tt.ruleEngine, tt.tag); errCodeOf(err) != tt.wantErr {
+				t.Errorf("checkNewTag() = %v, want errCode %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenameTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		newTag  string
+		wantErr uint
+	}{
+		{"default and split tag", "v1", "v9", 0},
+		{"aliased tag", "v2", "v9", 0},
+		{"shadow tag", "v3", "v9", 0},
+		{"onto existing tag", "v1", "v2", entities.ErrCodeTagAlreadyExist},
+		{"onto alias", "v1", "stable", entities.ErrCodeAliasConflict},
+		{"unknown tag", "v8", "v9", entities.ErrCodeTagNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleEngine := testRuleEngine()
+			ruleEngine.Tags["v4"].PreviousDefaultTag = tt.tag
+			before := testRuleEngine()
+
+			err := renameTag(ruleEngine, tt.tag, tt.newTag)
+			if errCodeOf(err) != tt.wantErr {
+				t.Fatalf("renameTag() = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr != 0 {
+				return
+			}
+
+			renamed := func(tag string) string {
+				if tag == tt.tag {
+					return tt.newTag
+				}
+				return tag
+			}
+			if tag := ruleEngine.Tags[tt.newTag]; tag == nil || tag.Name != tt.newTag || ruleEngine.Tags[tt.tag] != nil {
+				t.Errorf("tag not renamed, tags %v", ruleEngine.Tags)
+			}
+			if ruleEngine.DefaultTag != renamed(before.DefaultTag) || ruleEngine.ShadowTag != renamed(before.ShadowTag) ||
+				ruleEngine.Aliases["stable"] != renamed(before.Aliases["stable"]) || ruleEngine.TrafficSplit[0].Tag != renamed(before.TrafficSplit[0].Tag) {
+				t.Errorf("references not renamed, %+v", ruleEngine)
+			}
+			for i, tag := range before.DefaultTagHistory {
+				if ruleEngine.DefaultTagHistory[i] != renamed(tag) {
+					t.Errorf("history = %v", ruleEngine.DefaultTagHistory)
+				}
+			}
+			if previous := ruleEngine.Tags[renamed("v4")].PreviousDefaultTag; previous != tt.newTag {
+				t.Errorf("previous default = %v, want %v", previous, tt.newTag)
+			}
+		})
+	}
+}
+
+func TestRuleEngineOf(t *testing.T) {
+	spec := func() *entities.RuleEngineSpec {
+		return &entities.RuleEngineSpec{
+			Name:       "shop",
+			DefaultTag: "v2",
+			Tags: map[string]*entities.TagSpec{
+				"v1": {IsEnable: true, Config: testConfig(t)},
+				"v2": {IsEnable: true, Config: testConfig(t)},
+				"v3": {IsEnable: false, Config: testConfig(t)},
+			},
+			Aliases:      map[string]string{"stable": "v1"},
+			TrafficSplit: []*entities.TagWeight{{Tag: "v1", Weight: 100}},
+			ShadowTag:    "v2",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		modify      func(*entities.RuleEngineSpec)
+		replaced    *entities.RuleEngine
+		wantErr     uint
+		wantHistory []string
+	}{
+		{"new RuleEngine", func(*entities.RuleEngineSpec) {}, nil, 0, nil},
+		{"replaced RuleEngine", func(*entities.RuleEngineSpec) {}, &entities.RuleEngine{DefaultTag: "v1", Version: 7, DefaultTagHistory: []string{"v4", "v3"}}, 0, []string{"v4", "v3", "v1"}},
+		{"without tags", func(s *entities.RuleEngineSpec) { s.Tags = nil }, nil, entities.ErrCodeTagNotFound, nil},
+		{"disabled default", func(s *entities.RuleEngineSpec) { s.DefaultTag = "v3" }, nil, entities.ErrCodeDefaultTagExistAndMustBeEnabled, nil},
+		{"alias of disabled tag", func(s *entities.RuleEngineSpec) { s.Aliases = map[string]string{"old": "v3"} }, nil, entities.ErrCodeAliasTagMustBeEnabled, nil},
+		{"alias as tag name", func(s *entities.RuleEngineSpec) { s.Aliases = map[string]string{"v3": "v1"} }, nil, entities.ErrCodeAliasConflict, nil},
+		{"invalid traffic split", func(s *entities.RuleEngineSpec) { s.TrafficSplit[0].Weight = 50 }, nil, entities.ErrCodeInvalidTrafficSplit, nil},
+		{"disabled shadow", func(s *entities.RuleEngineSpec) { s.ShadowTag = "v3" }, nil, entities.ErrCodeShadowTagMustBeEnabled, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log.Logger = zap.NewNop()
+			s := spec()
+			tt.modify(s)
+			engineConfigIDs := map[string]primitive.ObjectID{}
+			for tag := range s.Tags {
+				engineConfigIDs[tag] = primitive.NewObjectID()
+			}
+
+			ruleEngine, err := ruleEngineOf(s, tt.replaced, engineConfigIDs)
+			if errCodeOf(err) != tt.wantErr {
+				t.Fatalf("ruleEngineOf() error = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr != 0 {
+				return
+			}
+
+			if ruleEngine.DefaultTag != "v2" || ruleEngine.ShadowTag != "v2" || ruleEngine.Aliases["stable"] != "v1" || len(ruleEngine.TrafficSplit) != 1 {
+				t.Errorf("unexpected routing %+v", ruleEngine)
+			}
+			for tag, tagSpec := range s.Tags {
+				got := ruleEngine.Tags[tag]
+				if got.IsEnable != tagSpec.IsEnable || got.EngineConfigID != engineConfigIDs[tag] || got.Digest == "" {
+					t.Errorf("unexpected tag %+v", got)
+				}
+			}
+			if tt.replaced != nil && ruleEngine.Version != tt.replaced.Version {
+				t.Errorf("version = %v, want %v", ruleEngine.Version, tt.replaced.Version)
+			}
+			if !reflect.DeepEqual(ruleEngine.DefaultTagHistory, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", ruleEngine.DefaultTagHistory, tt.wantHistory)
+			}
+		})
+	}
+}
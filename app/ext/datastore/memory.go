@@ -0,0 +1,308 @@
+package datastore
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryBackend keeps records in memory, meant for development and tests only as nothing is persisted.
+// Read-write transactions are serialized, read-only transactions run concurrently.
+type memoryBackend struct {
+	mutex       sync.RWMutex
+	ruleEngines map[string]*entities.RuleEngine
+	configs     map[primitive.ObjectID]*ruleenginecore.RuleEngineConfig
+
+	// map of RuleEngine name and disagreements, oldest first
+	disagreements map[string][]*entities.ShadowDisagreement
+
+	// map of RuleEngine name and audit events, oldest first
+	auditEvents map[string][]*entities.AuditEvent
+}
+
+// memoryTx stages writes and applies them to backend on commit
+type memoryTx struct {
+	backend  *memoryBackend
+	writable bool
+
+	// staged writes, nil value as deleted
+	ruleEngines map[string]*entities.RuleEngine
+	configs     map[primitive.ObjectID]*ruleenginecore.RuleEngineConfig
+
+	// staged disagreements, deletion is applied before additions
+	disagreements        []*entities.ShadowDisagreement
+	deletedDisagreements map[string]bool
+
+	// staged audit events
+	auditEvents []*entities.AuditEvent
+
+	// staged renames as map of RuleEngine name and new name, applied before additions
+	renamedDisagreements map[string]string
+	renamedAuditEvents   map[string]string
+}
+
+func newMemoryStore() *txnStore {
+	log.Logger.Warn("In-memory datastore is in use, RuleEngines are not persisted")
+	return &txnStore{backend: &memoryBackend{
+		ruleEngines:   map[string]*entities.RuleEngine{},
+		configs:       map[primitive.ObjectID]*ruleenginecore.RuleEngineConfig{},
+		disagreements: map[string][]*entities.ShadowDisagreement{},
+		auditEvents:   map[string][]*entities.AuditEvent{},
+	}}
+}
+
+func (b *memoryBackend) view(ctx context.Context, fn func(tx) error) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return fn(b.newTx(false))
+}
+
+func (b *memoryBackend) update(ctx context.Context, fn func(tx) error) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	t := b.newTx(true)
+	if err := fn(t); err != nil {
+		return err
+	}
+
+	for name, ruleEngine := range t.ruleEngines {
+		if ruleEngine == nil {
+			delete(b.ruleEngines, name)
+		} else {
+			b.ruleEngines[name] = ruleEngine
+		}
+	}
+	for id, config := range t.configs {
+		if config == nil {
+			delete(b.configs, id)
+		} else {
+			b.configs[id] = config
+		}
+	}
+	for name := range t.deletedDisagreements {
+		delete(b.disagreements, name)
+	}
+	for name, newName := range t.renamedDisagreements {
+		for _, disagreement := range b.disagreements[name] {
+			renamed := *disagreement
+			renamed.RuleEngine = newName
+			b.disagreements[newName] = append(b.disagreements[newName], &renamed)
+		}
+		delete(b.disagreements, name)
+		sort.Slice(b.disagreements[newName], func(i, j int) bool {
+			return bytes.Compare(b.disagreements[newName][i].ID[:], b.disagreements[newName][j].ID[:]) < 0
+		})
+	}
+	for name, newName := range t.renamedAuditEvents {
+		for _, event := range b.auditEvents[name] {
+			renamed := *event
+			renamed.RuleEngine = newName
+			b.auditEvents[newName] = append(b.auditEvents[newName], &renamed)
+		}
+		delete(b.auditEvents, name)
+		sort.Slice(b.auditEvents[newName], func(i, j int) bool {
+			return bytes.Compare(b.auditEvents[newName][i].ID[:], b.auditEvents[newName][j].ID[:]) < 0
+		})
+	}
+	for _, disagreement := range t.disagreements {
+		b.disagreements[disagreement.RuleEngine] = append(b.disagreements[disagreement.RuleEngine], disagreement)
+	}
+	for _, event := range t.auditEvents {
+		b.auditEvents[event.RuleEngine] = append(b.auditEvents[event.RuleEngine], event)
+	}
+	return nil
+}
+
+func (b *memoryBackend) close(ctx context.Context) error {
+	return nil
+}
+
+func (b *memoryBackend) newTx(writable bool) *memoryTx {
+	return &memoryTx{
+		backend:              b,
+		writable:             writable,
+		ruleEngines:          map[string]*entities.RuleEngine{},
+		configs:              map[primitive.ObjectID]*ruleenginecore.RuleEngineConfig{},
+		deletedDisagreements: map[string]bool{},
+		renamedDisagreements: map[string]string{},
+		renamedAuditEvents:   map[string]string{},
+	}
+}
+
+func (t *memoryTx) getRuleEngine(ruleEngineName string) (*entities.RuleEngine, error) {
+	ruleEngine, staged := t.ruleEngines[ruleEngineName]
+	if !staged {
+		ruleEngine = t.backend.ruleEngines[ruleEngineName]
+	}
+	return copyRuleEngine(ruleEngine), nil
+}
+
+func (t *memoryTx) listRuleEngines() ([]*entities.RuleEngine, error) {
+	names := map[string]bool{}
+	for name := range t.backend.ruleEngines {
+		names[name] = true
+	}
+	for name := range t.ruleEngines {
+		names[name] = true
+	}
+
+	ruleEngines := []*entities.RuleEngine{}
+	for name := range names {
+		if ruleEngine, _ := t.getRuleEngine(name); ruleEngine != nil {
+			ruleEngines = append(ruleEngines, ruleEngine)
+		}
+	}
+
+	sort.Slice(ruleEngines, func(i, j int) bool {
+		return ruleEngines[i].Name < ruleEngines[j].Name
+	})
+	return ruleEngines, nil
+}
+
+func (t *memoryTx) putRuleEngine(ruleEngine *entities.RuleEngine) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	ruleEngine.Version++
+	t.ruleEngines[ruleEngine.Name] = copyRuleEngine(ruleEngine)
+	return nil
+}
+
+func (t *memoryTx) deleteRuleEngine(ruleEngineName string) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.ruleEngines[ruleEngineName] = nil
+	return nil
+}
+
+func (t *memoryTx) getConfig(id primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error) {
+	if config, staged := t.configs[id]; staged {
+		return config, nil
+	}
+	return t.backend.configs[id], nil
+}
+
+// config is considered immutable once stored
+func (t *memoryTx) putConfig(engineConfig *entities.EngineConfig) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.configs[engineConfig.ID] = engineConfig.EngineCoreConfig
+	return nil
+}
+
+func (t *memoryTx) deleteConfig(id primitive.ObjectID) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.configs[id] = nil
+	return nil
+}
+
+func (t *memoryTx) putShadowDisagreement(disagreement *entities.ShadowDisagreement) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.disagreements = append(t.disagreements, disagreement)
+	return nil
+}
+
+// staged disagreements are not visible, they are only written by SaveShadowDisagreement
+func (t *memoryTx) listShadowDisagreements(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.ShadowDisagreement, error) {
+	result := []*entities.ShadowDisagreement{}
+	if t.deletedDisagreements[ruleEngineName] {
+		return result, nil
+	}
+
+	disagreements := t.backend.disagreements[ruleEngineName]
+	for i := len(disagreements) - 1; i >= 0 && len(result) < limit; i-- {
+		if before.IsZero() || bytes.Compare(disagreements[i].ID[:], before[:]) < 0 {
+			result = append(result, disagreements[i])
+		}
+	}
+	return result, nil
+}
+
+func (t *memoryTx) deleteShadowDisagreements(ruleEngineName string) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.deletedDisagreements[ruleEngineName] = true
+	return nil
+}
+
+func (t *memoryTx) putAuditEvent(event *entities.AuditEvent) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.auditEvents = append(t.auditEvents, event)
+	return nil
+}
+
+// staged audit events are not visible, listing is done in read-only transaction
+func (t *memoryTx) listAuditEvents(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.AuditEvent, error) {
+	result := []*entities.AuditEvent{}
+	events := t.backend.auditEvents[ruleEngineName]
+	for i := len(events) - 1; i >= 0 && len(result) < limit; i-- {
+		if before.IsZero() || bytes.Compare(events[i].ID[:], before[:]) < 0 {
+			result = append(result, events[i])
+		}
+	}
+	return result, nil
+}
+
+func (t *memoryTx) renameShadowDisagreements(ruleEngineName string, newRuleEngineName string) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.renamedDisagreements[ruleEngineName] = newRuleEngineName
+	return nil
+}
+
+func (t *memoryTx) renameAuditEvents(ruleEngineName string, newRuleEngineName string) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.renamedAuditEvents[ruleEngineName] = newRuleEngineName
+	return nil
+}
+
+// copyRuleEngine deep copies RuleEngine, so that stored records are never mutated outside of transaction
+func copyRuleEngine(ruleEngine *entities.RuleEngine) *entities.RuleEngine {
+	if ruleEngine == nil {
+		return nil
+	}
+
+	copied := *ruleEngine
+	copied.Tags = make(map[string]*entities.Tag, len(ruleEngine.Tags))
+	for name, tag := range ruleEngine.Tags {
+		t := *tag
+		copied.Tags[name] = &t
+	}
+	if ruleEngine.TrafficSplit != nil {
+		copied.TrafficSplit = make([]*entities.TagWeight, 0, len(ruleEngine.TrafficSplit))
+		for _, tw := range ruleEngine.TrafficSplit {
+			w := *tw
+			copied.TrafficSplit = append(copied.TrafficSplit, &w)
+		}
+	}
+	if ruleEngine.DefaultTagHistory != nil {
+		copied.DefaultTagHistory = append([]string{}, ruleEngine.DefaultTagHistory...)
+	}
+	if ruleEngine.Aliases != nil {
+		copied.Aliases = make(map[string]string, len(ruleEngine.Aliases))
+		for alias, tag := range ruleEngine.Aliases {
+			copied.Aliases[alias] = tag
+		}
+	}
+	return &copied
+}
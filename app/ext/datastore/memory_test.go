@@ -0,0 +1,477 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/audit"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+func newTestMemoryStore(t *testing.T) *txnStore {
+	t.Helper()
+	log.Logger = zap.NewNop()
+	return newMemoryStore()
+}
+
+// changedTestConfig differs from testConfig by rule priority
+func changedTestConfig(t *testing.T) *ruleenginecore.RuleEngineConfig {
+	t.Helper()
+	config := testConfig(t)
+	config.Rules["r1"].Priority = 2
+	return config
+}
+
+// storeStep is a store call along with errCode it is expected to fail with, 0 as success
+type storeStep struct {
+	name    string
+	run     func() *entities.Error
+	wantErr uint
+}
+
+func runStoreSteps(t *testing.T, steps []storeStep) {
+	t.Helper()
+	for _, step := range steps {
+		if err := step.run(); errCodeOf(err) != step.wantErr {
+			t.Fatalf("%v = %v, want errCode %v", step.name, err, step.wantErr)
+		}
+	}
+}
+
+func TestMemoryTxn(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+	if err := store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed transaction writes nothing
+	failed := errors.New("failed")
+	err := store.backend.update(ctx, func(t tx) error {
+		if err := t.deleteRuleEngine("shop"); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("update() = %v, want %v", err, failed)
+	}
+
+	// read-only transaction rejects writes
+	err = store.backend.view(ctx, func(t tx) error {
+		return t.deleteRuleEngine("shop")
+	})
+	if err != errReadOnlyTxn {
+		t.Errorf("view() write = %v, want %v", err, errReadOnlyTxn)
+	}
+
+	// returned RuleEngine is a copy
+	ruleEngine, dsErr := store.GetRuleEngine(ctx, "shop")
+	if dsErr != nil || ruleEngine == nil {
+		t.Fatalf("GetRuleEngine() = %v, %v", ruleEngine, dsErr)
+	}
+	ruleEngine.Tags["v1"].IsEnable = true
+	ruleEngine.DefaultTag = "v1"
+
+	stored, _ := store.GetRuleEngine(ctx, "shop")
+	if stored.DefaultTag != "" || stored.Tags["v1"].IsEnable {
+		t.Errorf("stored RuleEngine modified through returned copy, %+v", stored)
+	}
+}
+
+func TestMemoryStoreTagInvariants(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+
+	runStoreSteps(t, []storeStep{
+		{"create", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)) }, 0},
+		{"create existing tag", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)) }, entities.ErrCodeTagAlreadyExist},
+		{"create second tag", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v2", testConfig(t)) }, 0},
+		{"set disabled default", func() *entities.Error { return store.SetDefaultTag(ctx, "shop", "v1") }, entities.ErrCodeDefaultTagExistAndMustBeEnabled},
+		{"enable", func() *entities.Error { return store.EnableTag(ctx, "shop", "v1") }, 0},
+		{"enable unknown tag", func() *entities.Error { return store.EnableTag(ctx, "shop", "v9") }, entities.ErrCodeTagNotFound},
+		{"enable of unknown RuleEngine", func() *entities.Error { return store.EnableTag(ctx, "cart", "v1") }, entities.ErrCodeRuleEngineNotFound},
+		{"set default", func() *entities.Error { return store.SetDefaultTag(ctx, "shop", "v1") }, 0},
+		{"disable default", func() *entities.Error { return store.DisableTag(ctx, "shop", "v1") }, entities.ErrCodeTagDisableNotAllowed},
+		{"update enabled tag config", func() *entities.Error { return store.UpdateTagConfig(ctx, "shop", "v1", changedTestConfig(t)) }, entities.ErrCodeTagUpdateNotAllowed},
+		{"update disabled tag config", func() *entities.Error { return store.UpdateTagConfig(ctx, "shop", "v2", changedTestConfig(t)) }, 0},
+		{"alias of disabled tag", func() *entities.Error { return store.SetAlias(ctx, "shop", "stable", "v2") }, entities.ErrCodeAliasTagMustBeEnabled},
+		{"enable second tag", func() *entities.Error { return store.EnableTag(ctx, "shop", "v2") }, 0},
+		{"alias", func() *entities.Error { return store.SetAlias(ctx, "shop", "stable", "v2") }, 0},
+		{"alias as tag name", func() *entities.Error { return store.SetAlias(ctx, "shop", "v1", "v2") }, entities.ErrCodeAliasConflict},
+		{"create tag as alias name", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "stable", testConfig(t)) }, entities.ErrCodeAliasConflict},
+		{"disable aliased tag", func() *entities.Error { return store.DisableTag(ctx, "shop", "v2") }, entities.ErrCodeTagDisableNotAllowed},
+		{"invalid traffic split", func() *entities.Error {
+			return store.SetTrafficSplit(ctx, "shop", []*entities.TagWeight{{Tag: "v1", Weight: 50}})
+		}, entities.ErrCodeInvalidTrafficSplit},
+		{"traffic split", func() *entities.Error {
+			return store.SetTrafficSplit(ctx, "shop", []*entities.TagWeight{{Tag: "v1", Weight: 90}, {Tag: "v2", Weight: 10}})
+		}, 0},
+		{"delete alias", func() *entities.Error { return store.DeleteAlias(ctx, "shop", "stable") }, 0},
+		{"disable split tag", func() *entities.Error { return store.DisableTag(ctx, "shop", "v2") }, entities.ErrCodeTagDisableNotAllowed},
+		{"remove traffic split", func() *entities.Error { return store.SetTrafficSplit(ctx, "shop", nil) }, 0},
+		{"shadow", func() *entities.Error { return store.SetShadowTag(ctx, "shop", "v2") }, 0},
+		{"delete enabled tag", func() *entities.Error { return store.DeleteRuleEngineConfig(ctx, "shop", "v2") }, entities.ErrCodeTagDeleteNotAllowed},
+		{"unset shadow", func() *entities.Error { return store.SetShadowTag(ctx, "shop", "") }, 0},
+		{"disable", func() *entities.Error { return store.DisableTag(ctx, "shop", "v2") }, 0},
+		{"delete", func() *entities.Error { return store.DeleteRuleEngineConfig(ctx, "shop", "v2") }, 0},
+	})
+
+	ruleEngine, err := store.GetRuleEngine(ctx, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ruleEngine.DefaultTag != "v1" || len(ruleEngine.Tags) != 1 || len(ruleEngine.Aliases) != 0 || len(ruleEngine.TrafficSplit) != 0 || ruleEngine.ShadowTag != "" {
+		t.Errorf("unexpected RuleEngine %+v", ruleEngine)
+	}
+
+	// config of deleted tag is deleted as well
+	backend := store.backend.(*memoryBackend)
+	if len(backend.configs) != 1 {
+		t.Errorf("%v configs stored, want 1", len(backend.configs))
+	}
+}
+
+func TestMemoryStoreGetTagConfig(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+	runStoreSteps(t, []storeStep{
+		{"create", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)) }, 0},
+		{"create second tag", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v2", changedTestConfig(t)) }, 0},
+		{"enable", func() *entities.Error { return store.EnableTag(ctx, "shop", "v2") }, 0},
+		{"alias", func() *entities.Error { return store.SetAlias(ctx, "shop", "stable", "v2") }, 0},
+	})
+	ruleEngine, _ := store.GetRuleEngine(ctx, "shop")
+
+	tests := []struct {
+		name    string
+		tag     string
+		wantTag string
+		wantErr uint
+	}{
+		{"tag", "v1", "v1", 0},
+		{"alias", "stable", "v2", 0},
+		{"digest", "@" + ruleEngine.Tags["v1"].Digest, "v1", 0},
+		{"default not set", "", "", entities.ErrCodeDefaultTagNotSet},
+		{"unknown tag", "v9", "", entities.ErrCodeTagNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, config, err := store.GetTagConfig(ctx, "shop", tt.tag)
+			if errCodeOf(err) != tt.wantErr {
+				t.Fatalf("GetTagConfig() error = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr == 0 && (tag.Name != tt.wantTag || config == nil) {
+				t.Errorf("GetTagConfig() = %v, %v, want %v", tag.Name, config, tt.wantTag)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreRollback(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+
+	steps := []storeStep{
+		{"rollback of unknown RuleEngine", func() *entities.Error { _, err := store.RollbackDefaultTag(ctx, "shop"); return err }, entities.ErrCodeRuleEngineNotFound},
+	}
+	for _, tag := range []string{"v1", "v2", "v3", "v4"} {
+		tag := tag
+		steps = append(steps,
+			storeStep{"create " + tag, func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", tag, testConfig(t)) }, 0},
+			storeStep{"enable " + tag, func() *entities.Error { return store.EnableTag(ctx, "shop", tag) }, 0},
+			storeStep{"set default " + tag, func() *entities.Error { return store.SetDefaultTag(ctx, "shop", tag) }, 0},
+		)
+	}
+	steps = append(steps,
+		storeStep{"disable v3", func() *entities.Error { return store.DisableTag(ctx, "shop", "v3") }, 0},
+		storeStep{"delete v3", func() *entities.Error { return store.DeleteRuleEngineConfig(ctx, "shop", "v3") }, 0},
+		storeStep{"rollback to deleted v3", func() *entities.Error { _, err := store.RollbackDefaultTag(ctx, "shop"); return err }, entities.ErrCodePreviousDefaultTagDeleted},
+		// explicit default moves past deleted v3
+		storeStep{"set default v1", func() *entities.Error { return store.SetDefaultTag(ctx, "shop", "v1") }, 0},
+	)
+	runStoreSteps(t, steps)
+
+	// rollback restores v4, then deleted v3 stops the walk back
+	tag, err := store.RollbackDefaultTag(ctx, "shop")
+	if err != nil || tag != "v4" {
+		t.Fatalf("RollbackDefaultTag() = %v, %v, want v4", tag, err)
+	}
+	if _, err := store.RollbackDefaultTag(ctx, "shop"); errCodeOf(err) != entities.ErrCodePreviousDefaultTagDeleted {
+		t.Errorf("RollbackDefaultTag() to deleted tag = %v", err)
+	}
+	if ruleEngine, _ := store.GetRuleEngine(ctx, "shop"); ruleEngine.DefaultTag != "v4" {
+		t.Errorf("failed rollback changed default to %v", ruleEngine.DefaultTag)
+	}
+}
+
+func TestMemoryStoreSchedule(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := audit.NewContext(context.Background(), &audit.Origin{Actor: "scheduler"})
+	runStoreSteps(t, []storeStep{
+		{"create", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)) }, 0},
+		{"create second tag", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v2", testConfig(t)) }, 0},
+		{"enable", func() *entities.Error { return store.EnableTag(ctx, "shop", "v1") }, 0},
+		{"set default", func() *entities.Error { return store.SetDefaultTag(ctx, "shop", "v1") }, 0},
+		{"schedule unknown tag", func() *entities.Error { return store.SetTagSchedule(ctx, "shop", "v9", 100, 200) }, entities.ErrCodeTagNotFound},
+		{"schedule", func() *entities.Error { return store.SetTagSchedule(ctx, "shop", "v2", 100, 200) }, 0},
+	})
+
+	tests := []struct {
+		now         int64
+		wantDue     int
+		wantChanged bool
+		wantDefault string
+	}{
+		{50, 0, false, "v1"},
+		{100, 1, true, "v2"},
+		{150, 0, false, "v2"},
+		{200, 1, true, "v1"},
+	}
+	for _, tt := range tests {
+		due, err := store.GetRuleEnginesScheduledBy(ctx, tt.now)
+		if err != nil || len(due) != tt.wantDue {
+			t.Fatalf("GetRuleEnginesScheduledBy(%v) = %v, %v, want %v", tt.now, len(due), err, tt.wantDue)
+		}
+		changed, err := store.ApplySchedule(ctx, "shop", tt.now)
+		if err != nil || changed != tt.wantChanged {
+			t.Fatalf("ApplySchedule(%v) = %v, %v, want %v", tt.now, changed, err, tt.wantChanged)
+		}
+		if ruleEngine, _ := store.GetRuleEngine(ctx, "shop"); ruleEngine.DefaultTag != tt.wantDefault {
+			t.Errorf("default at %v = %v, want %v", tt.now, ruleEngine.DefaultTag, tt.wantDefault)
+		}
+	}
+
+	events, _ := store.ListAuditEvents(ctx, "shop", primitive.NilObjectID, 2)
+	if len(events) != 2 || events[0].Operation != entities.AuditOpScheduledExpiry || events[1].Operation != entities.AuditOpScheduledActivation || events[0].Actor != "scheduler" {
+		t.Errorf("unexpected audit events %+v", events)
+	}
+}
+
+func TestMemoryBackfillDigests(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+	if err := store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)); err != nil {
+		t.Fatal(err)
+	}
+	ruleEngine, _ := store.GetRuleEngine(ctx, "shop")
+	want := ruleEngine.Tags["v1"].Digest
+
+	// tag stored before digests
+	err := store.backend.update(ctx, func(t tx) error {
+		ruleEngine.Tags["v1"].Digest = ""
+		return t.putRuleEngine(ruleEngine)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.backfillDigests(ctx); err != nil {
+		t.Fatal(err)
+	}
+	backfilled, _ := store.GetRuleEngine(ctx, "shop")
+	if backfilled.Tags["v1"].Digest != want || backfilled.Version <= ruleEngine.Version {
+		t.Errorf("digest %v, version %v, want %v", backfilled.Tags["v1"].Digest, backfilled.Version, want)
+	}
+}
+
+func TestMemoryStoreSetAlias(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+	runStoreSteps(t, []storeStep{
+		{"create", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)) }, 0},
+		{"alias of disabled tag", func() *entities.Error { return store.SetAlias(ctx, "shop", "stable", "v1") }, entities.ErrCodeAliasTagMustBeEnabled},
+		{"alias of unknown RuleEngine", func() *entities.Error { return store.SetAlias(ctx, "cart", "stable", "v1") }, entities.ErrCodeRuleEngineNotFound},
+		{"enable", func() *entities.Error { return store.EnableTag(ctx, "shop", "v1") }, 0},
+		{"alias", func() *entities.Error { return store.SetAlias(ctx, "shop", "stable", "v1") }, 0},
+	})
+	aliased, _ := store.GetRuleEngine(ctx, "shop")
+
+	// alias already pointing to tag is neither written nor audited
+	if err := store.SetAlias(ctx, "shop", "stable", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if ruleEngine, _ := store.GetRuleEngine(ctx, "shop"); ruleEngine.Version != aliased.Version {
+		t.Errorf("version %v, want %v", ruleEngine.Version, aliased.Version)
+	}
+	events, _ := store.ListAuditEvents(ctx, "shop", primitive.NilObjectID, 100)
+	if len(events) == 0 || events[0].Operation != entities.AuditOpSetAlias || countOf(events, entities.AuditOpSetAlias) != 1 {
+		t.Errorf("unexpected audit events %+v", events)
+	}
+}
+
+func countOf(events []*entities.AuditEvent, operation string) int {
+	count := 0
+	for _, event := range events {
+		if event.Operation == operation {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMemoryStoreSetShadowTag(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+	runStoreSteps(t, []storeStep{
+		{"create", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)) }, 0},
+		{"shadow of disabled tag", func() *entities.Error { return store.SetShadowTag(ctx, "shop", "v1") }, entities.ErrCodeShadowTagMustBeEnabled},
+		{"enable", func() *entities.Error { return store.EnableTag(ctx, "shop", "v1") }, 0},
+		{"shadow", func() *entities.Error { return store.SetShadowTag(ctx, "shop", "v1") }, 0},
+		{"shadow again", func() *entities.Error { return store.SetShadowTag(ctx, "shop", "v1") }, 0},
+		{"unset shadow", func() *entities.Error { return store.SetShadowTag(ctx, "shop", "") }, 0},
+		{"unset shadow again", func() *entities.Error { return store.SetShadowTag(ctx, "shop", "") }, 0},
+	})
+
+	// unchanged shadow tag is not audited
+	events, _ := store.ListAuditEvents(ctx, "shop", primitive.NilObjectID, 100)
+	if shadowEvents := countOf(events, entities.AuditOpSetShadowTag); shadowEvents != 2 {
+		t.Errorf("%v shadow tag changes audited, want 2", shadowEvents)
+	}
+}
+
+func TestMemoryStoreRename(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+	runStoreSteps(t, []storeStep{
+		{"create", func() *entities.Error { return store.CreateRuleEngine(ctx, "shop", "v1", testConfig(t)) }, 0},
+		{"create other", func() *entities.Error { return store.CreateRuleEngine(ctx, "cart", "v1", testConfig(t)) }, 0},
+		{"enable", func() *entities.Error { return store.EnableTag(ctx, "shop", "v1") }, 0},
+		{"alias", func() *entities.Error { return store.SetAlias(ctx, "shop", "stable", "v1") }, 0},
+		{"clone", func() *entities.Error { return store.CloneTag(ctx, "shop", "stable", "shop", "v2") }, 0},
+		{"clone onto existing tag", func() *entities.Error { return store.CloneTag(ctx, "shop", "v1", "cart", "v1") }, entities.ErrCodeTagAlreadyExist},
+		{"rename tag onto alias", func() *entities.Error { return store.RenameTag(ctx, "shop", "v1", "stable") }, entities.ErrCodeAliasConflict},
+		{"rename tag", func() *entities.Error { return store.RenameTag(ctx, "shop", "v1", "v1a") }, 0},
+		{"rename onto existing RuleEngine", func() *entities.Error { return store.RenameRuleEngine(ctx, "shop", "cart") }, entities.ErrCodeRuleEngineAlreadyExist},
+		{"rename", func() *entities.Error { return store.RenameRuleEngine(ctx, "shop", "store") }, 0},
+	})
+
+	if ruleEngine, _ := store.GetRuleEngine(ctx, "shop"); ruleEngine != nil {
+		t.Errorf("RuleEngine kept under former name")
+	}
+	ruleEngine, err := store.GetRuleEngine(ctx, "store")
+	if err != nil || ruleEngine == nil {
+		t.Fatalf("GetRuleEngine() = %v, %v", ruleEngine, err)
+	}
+	if ruleEngine.Aliases["stable"] != "v1a" || ruleEngine.Tags["v2"] == nil || ruleEngine.Tags["v2"].IsEnable {
+		t.Errorf("unexpected RuleEngine %+v", ruleEngine)
+	}
+
+	// audit events continue under new name
+	events, _ := store.ListAuditEvents(ctx, "store", primitive.NilObjectID, 100)
+	if len(events) == 0 || events[0].Operation != entities.AuditOpRenameRuleEngine || events[0].Detail != "shop" {
+		t.Errorf("unexpected audit events %+v", events)
+	}
+	if former, _ := store.ListAuditEvents(ctx, "shop", primitive.NilObjectID, 100); len(former) != 0 {
+		t.Errorf("%v audit events kept under former name", len(former))
+	}
+}
+
+func TestMemoryStoreImport(t *testing.T) {
+	spec := func(defaultTag string) *entities.RuleEngineSpec {
+		return &entities.RuleEngineSpec{
+			Name:       "shop",
+			DefaultTag: defaultTag,
+			Tags: map[string]*entities.TagSpec{
+				"v1": {IsEnable: true, Config: testConfig(t)},
+				"v2": {IsEnable: true, Config: changedTestConfig(t)},
+			},
+			Aliases: map[string]string{"stable": "v1"},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		policy      string
+		specs       []*entities.RuleEngineSpec
+		wantErr     uint
+		wantResult  *entities.ImportResult
+		wantDefault string
+		wantHistory []string
+	}{
+		{"fail on existing", entities.ImportPolicyFail, []*entities.RuleEngineSpec{spec("v2")}, entities.ErrCodeRuleEngineAlreadyExist, nil, "v1", nil},
+		{"skip existing", entities.ImportPolicySkip, []*entities.RuleEngineSpec{spec("v2")}, 0,
+			&entities.ImportResult{Created: []string{}, Overwritten: []string{}, Skipped: []string{"shop"}}, "v1", nil},
+		{"overwrite existing", entities.ImportPolicyOverwrite, []*entities.RuleEngineSpec{spec("v2")}, 0,
+			&entities.ImportResult{Created: []string{}, Overwritten: []string{"shop"}, Skipped: []string{}}, "v2", []string{"v1"}},
+		{"invalid spec imports nothing", entities.ImportPolicyOverwrite, []*entities.RuleEngineSpec{spec("v2"), spec("v9")}, entities.ErrCodeDefaultTagExistAndMustBeEnabled, nil, "v1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestMemoryStore(t)
+			ctx := context.Background()
+			if result, err := store.ImportRuleEngines(ctx, []*entities.RuleEngineSpec{spec("v1")}, entities.ImportPolicyFail); err != nil || len(result.Created) != 1 {
+				t.Fatalf("ImportRuleEngines() = %+v, %v", result, err)
+			}
+
+			result, err := store.ImportRuleEngines(ctx, tt.specs, tt.policy)
+			if errCodeOf(err) != tt.wantErr {
+				t.Fatalf("ImportRuleEngines() error = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantResult != nil && !reflect.DeepEqual(result, tt.wantResult) {
+				t.Errorf("ImportRuleEngines() = %+v, want %+v", result, tt.wantResult)
+			}
+
+			ruleEngine, _ := store.GetRuleEngine(ctx, "shop")
+			if ruleEngine.DefaultTag != tt.wantDefault || !reflect.DeepEqual(ruleEngine.DefaultTagHistory, tt.wantHistory) {
+				t.Errorf("default %v, history %v, want %v, %v", ruleEngine.DefaultTag, ruleEngine.DefaultTagHistory, tt.wantDefault, tt.wantHistory)
+			}
+			if ruleEngine.Aliases["stable"] != "v1" || len(ruleEngine.Tags) != 2 {
+				t.Errorf("unexpected RuleEngine %+v", ruleEngine)
+			}
+
+			// configs of overwritten tags are deleted
+			if configs := len(store.backend.(*memoryBackend).configs); configs != 2 {
+				t.Errorf("%v configs stored, want 2", configs)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreApply(t *testing.T) {
+	store := newTestMemoryStore(t)
+	ctx := context.Background()
+	desired := testPlanSpec(t)
+
+	// dry run reports plan without writing anything
+	steps, err := store.ApplyRuleEngine(ctx, desired, &entities.ApplyOptions{DryRun: true})
+	if err != nil || len(steps) == 0 {
+		t.Fatalf("ApplyRuleEngine() dry run = %v, %v", stepsOf(steps), err)
+	}
+	if ruleEngine, _ := store.GetRuleEngine(ctx, "shop"); ruleEngine != nil {
+		t.Fatalf("dry run created RuleEngine %+v", ruleEngine)
+	}
+
+	applied, err := store.ApplyRuleEngine(ctx, desired, &entities.ApplyOptions{})
+	if err != nil || !reflect.DeepEqual(stepsOf(applied), stepsOf(steps)) {
+		t.Fatalf("ApplyRuleEngine() = %v, %v, want %v", stepsOf(applied), err, stepsOf(steps))
+	}
+	events, _ := store.ListAuditEvents(ctx, "shop", primitive.NilObjectID, 100)
+	if len(events) != len(steps) {
+		t.Errorf("%v audit events, want %v", len(events), len(steps))
+	}
+
+	if again, err := store.ApplyRuleEngine(ctx, desired, &entities.ApplyOptions{}); err != nil || len(again) != 0 {
+		t.Errorf("ApplyRuleEngine() in sync = %v, %v, want none", stepsOf(again), err)
+	}
+
+	// plan violating invariants writes nothing, kept alias protects v2
+	if err := store.SetAlias(ctx, "shop", "canary", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := store.GetRuleEngine(ctx, "shop")
+	invalid := testPlanSpec(t)
+	delete(invalid.Tags, "v2")
+	if _, err := store.ApplyRuleEngine(ctx, invalid, &entities.ApplyOptions{KeepAliases: true}); errCodeOf(err) != entities.ErrCodeTagDisableNotAllowed {
+		t.Errorf("ApplyRuleEngine() invalid = %v", err)
+	}
+	if after, _ := store.GetRuleEngine(ctx, "shop"); !reflect.DeepEqual(after, before) {
+		t.Errorf("failed apply changed RuleEngine to %+v", after)
+	}
+}
@@ -0,0 +1,21 @@
+CREATE TABLE ruleengine (
+    name             TEXT PRIMARY KEY,
+    default_tag      TEXT NOT NULL DEFAULT '',
+    last_update_time BIGINT NOT NULL
+);
+
+CREATE INDEX ruleengine_last_update_time_idx ON ruleengine (last_update_time);
+
+CREATE TABLE ruleengineconfig (
+    id     TEXT PRIMARY KEY,
+    config JSONB NOT NULL
+);
+
+-- config is deleted before tag within same transaction, hence deferred
+CREATE TABLE ruleenginetag (
+    ruleengine_name  TEXT NOT NULL REFERENCES ruleengine (name) ON DELETE CASCADE,
+    name             TEXT NOT NULL,
+    engine_config_id TEXT NOT NULL REFERENCES ruleengineconfig (id) DEFERRABLE INITIALLY DEFERRED,
+    is_enable        BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (ruleengine_name, name)
+);
@@ -0,0 +1,2 @@
+-- content digest of RuleEngineConfig, empty for tags created before digests
+ALTER TABLE ruleenginetag ADD COLUMN digest TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+CREATE TABLE ruleenginealias (
+    ruleengine_name TEXT NOT NULL REFERENCES ruleengine (name) ON DELETE CASCADE,
+    name            TEXT NOT NULL,
+    tag             TEXT NOT NULL,
+    PRIMARY KEY (ruleengine_name, name)
+);
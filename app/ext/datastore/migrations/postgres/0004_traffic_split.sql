@@ -0,0 +1 @@
+ALTER TABLE ruleengine ADD COLUMN traffic_split JSONB NOT NULL DEFAULT '[]';
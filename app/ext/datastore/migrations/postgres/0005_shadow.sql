@@ -0,0 +1,10 @@
+ALTER TABLE ruleengine ADD COLUMN shadow_tag TEXT NOT NULL DEFAULT '';
+
+-- id is ObjectID hex, i.e. ordered by creation
+CREATE TABLE shadowdisagreement (
+    id              TEXT PRIMARY KEY,
+    ruleengine_name TEXT NOT NULL,
+    disagreement    JSONB NOT NULL
+);
+
+CREATE INDEX shadowdisagreement_ruleengine_idx ON shadowdisagreement (ruleengine_name, id);
@@ -0,0 +1,5 @@
+ALTER TABLE ruleengine ADD COLUMN next_schedule_time BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE ruleenginetag ADD COLUMN activate_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE ruleenginetag ADD COLUMN expire_at BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE ruleenginetag ADD COLUMN previous_default_tag TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- id is ObjectID hex, i.e. ordered by creation. retained after RuleEngine is deleted
+CREATE TABLE auditevent (
+    id              TEXT PRIMARY KEY,
+    ruleengine_name TEXT NOT NULL,
+    event           JSONB NOT NULL
+);
+
+CREATE INDEX auditevent_ruleengine_idx ON auditevent (ruleengine_name, id);
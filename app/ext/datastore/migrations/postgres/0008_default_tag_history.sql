@@ -0,0 +1 @@
+ALTER TABLE ruleengine ADD COLUMN default_tag_history JSONB NOT NULL DEFAULT '[]';
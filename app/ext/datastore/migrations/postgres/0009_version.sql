@@ -0,0 +1,2 @@
+-- incremented on every write, i.e. orders changes made within same second
+ALTER TABLE ruleengine ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
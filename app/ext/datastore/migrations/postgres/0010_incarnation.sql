@@ -0,0 +1,2 @@
+-- ObjectID hex assigned on creation and rename, empty for RuleEngines stored before incarnations
+ALTER TABLE ruleengine ADD COLUMN incarnation TEXT NOT NULL DEFAULT '';
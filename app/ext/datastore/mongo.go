@@ -2,12 +2,15 @@ package datastore
 
 import (
 	"context"
-	"os"
+	"regexp"
 	"time"
 
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
 	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/entities"
 	"github.com/niharrathod/ruleengine/app/log"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
@@ -17,19 +20,44 @@ import (
 )
 
 const (
-	database           = "ruleengineDB"
-	ruleEngineCollName = "ruleengine"
-	configCollName     = "ruleengineconfig"
+	database            = "ruleengineDB"
+	ruleEngineCollName  = "ruleengine"
+	configCollName      = "ruleengineconfig"
+	workerStateCollName = "workerstate"
+	shadowCollName      = "shadowdisagreement"
+	auditCollName       = "auditevent"
 )
 
-var client *mongo.Client
-var ruleEngineCollection *mongo.Collection
-var engineConfigCollection *mongo.Collection
+var _ Store = (*mongoStore)(nil)
+var _ ChangeStreamer = (*mongoStore)(nil)
 
-func Initialize() {
-	mongoUrl := config.Datastore.Mongo.Url
-	username := config.Datastore.Mongo.Username
-	password := config.Datastore.Mongo.Password
+// mongoStore is txnStore over mongoBackend, listings are served by collection indexes and RuleEngine changes by change stream
+type mongoStore struct {
+	*txnStore
+	ruleEngineCollection  *mongo.Collection
+	workerStateCollection *mongo.Collection
+}
+
+// mongoBackend persists records in MongoDB collections, every transaction runs in its own session.
+// RuleEngine is keyed by name, RuleEngineConfig by id.
+type mongoBackend struct {
+	client                 *mongo.Client
+	ruleEngineCollection   *mongo.Collection
+	engineConfigCollection *mongo.Collection
+	shadowCollection       *mongo.Collection
+	auditCollection        *mongo.Collection
+}
+
+type mongoTx struct {
+	ctx      context.Context
+	backend  *mongoBackend
+	writable bool
+}
+
+func newMongoStore(conf *config.MongoConf) (*mongoStore, error) {
+	mongoUrl := conf.Url
+	username := conf.Username
+	password := conf.Password
 
 	var clientOptions []*options.ClientOptions
 	if config.IsProduction() {
@@ -47,36 +75,322 @@ func Initialize() {
 			options.Client().SetWriteConcern(writeconcern.New(writeconcern.J(true), writeconcern.W(1)))}
 	}
 
-	mongoClient, err := mongo.Connect(context.TODO(), clientOptions...)
+	client, err := mongo.Connect(context.TODO(), clientOptions...)
 	if err != nil {
 		log.Logger.Error("Client connect failed", zap.String("error", err.Error()))
-		os.Exit(1)
+		return nil, err
 	}
 
-	client = mongoClient
-
 	pingCtx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 	if err := client.Ping(pingCtx, readpref.Primary()); err != nil {
 		log.Logger.Error("Client ping failed", zap.String("error", err.Error()))
-		os.Exit(1)
+		return nil, err
 	}
 
-	ruleEngineCollection = client.Database(database).Collection(ruleEngineCollName)
-	engineConfigCollection = client.Database(database).Collection(configCollName)
+	backend := &mongoBackend{
+		client:                 client,
+		ruleEngineCollection:   client.Database(database).Collection(ruleEngineCollName),
+		engineConfigCollection: client.Database(database).Collection(configCollName),
+		shadowCollection:       client.Database(database).Collection(shadowCollName),
+		auditCollection:        client.Database(database).Collection(auditCollName),
+	}
+	s := &mongoStore{
+		txnStore:              &txnStore{backend: backend},
+		ruleEngineCollection:  backend.ruleEngineCollection,
+		workerStateCollection: client.Database(database).Collection(workerStateCollName),
+	}
 
 	// RuleEngine name index
 	model := mongo.IndexModel{Keys: bson.D{{Key: "name", Value: 1}}}
-	name, err := ruleEngineCollection.Indexes().CreateOne(context.TODO(), model)
+	name, err := s.ruleEngineCollection.Indexes().CreateOne(context.TODO(), model)
+	if err != nil {
+		log.Logger.Error("MongoDB index creation failed", zap.String("error", err.Error()))
+		return nil, err
+	} else {
+		log.Logger.Info("MongoDB index creation succeed", zap.String("IndexName", name))
+	}
+
+	// RuleEngine lastUpdateTime index, for listing sorted by lastUpdateTime and polling changes
+	model = mongo.IndexModel{Keys: bson.D{{Key: "lastUpdateTime", Value: 1}, {Key: "name", Value: 1}}}
+	name, err = s.ruleEngineCollection.Indexes().CreateOne(context.TODO(), model)
 	if err != nil {
 		log.Logger.Error("MongoDB index creation failed", zap.String("error", err.Error()))
-		os.Exit(1)
+		return nil, err
 	} else {
 		log.Logger.Info("MongoDB index creation succeed", zap.String("IndexName", name))
 	}
+
+	// RuleEngine nextScheduleTime index, for scheduler to find due activations and expiries
+	model = mongo.IndexModel{Keys: bson.D{{Key: "nextScheduleTime", Value: 1}}}
+	name, err = s.ruleEngineCollection.Indexes().CreateOne(context.TODO(), model)
+	if err != nil {
+		log.Logger.Error("MongoDB index creation failed", zap.String("error", err.Error()))
+		return nil, err
+	} else {
+		log.Logger.Info("MongoDB index creation succeed", zap.String("IndexName", name))
+	}
+
+	// ShadowDisagreement ruleEngine index, for listing newest first
+	model = mongo.IndexModel{Keys: bson.D{{Key: "ruleEngine", Value: 1}, {Key: "_id", Value: -1}}}
+	name, err = backend.shadowCollection.Indexes().CreateOne(context.TODO(), model)
+	if err != nil {
+		log.Logger.Error("MongoDB index creation failed", zap.String("error", err.Error()))
+		return nil, err
+	} else {
+		log.Logger.Info("MongoDB index creation succeed", zap.String("IndexName", name))
+	}
+
+	// AuditEvent ruleEngine index, for history newest first
+	model = mongo.IndexModel{Keys: bson.D{{Key: "ruleEngine", Value: 1}, {Key: "_id", Value: -1}}}
+	name, err = backend.auditCollection.Indexes().CreateOne(context.TODO(), model)
+	if err != nil {
+		log.Logger.Error("MongoDB index creation failed", zap.String("error", err.Error()))
+		return nil, err
+	} else {
+		log.Logger.Info("MongoDB index creation succeed", zap.String("IndexName", name))
+	}
+
+	if err := s.backfillDigests(context.TODO()); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// ListRuleEngines served by name index, or lastUpdateTime and name index when sorted by lastUpdateTime
+func (s *mongoStore) ListRuleEngines(ctx context.Context, query *entities.ListRuleEnginesQuery) ([]*entities.RuleEngine, *entities.Error) {
+	direction := 1
+	cmp := "$gt"
+	if query.Descending {
+		direction = -1
+		cmp = "$lt"
+	}
+
+	filters := bson.A{}
+	if query.NamePrefix != "" {
+		// anchored prefix regex is served by name index
+		filters = append(filters, bson.M{"name": bson.M{"$regex": "^" + regexp.QuoteMeta(query.NamePrefix)}})
+	}
+
+	var sort bson.D
+	switch query.SortBy {
+	case entities.SortByLastUpdateTime:
+		sort = bson.D{{Key: "lastUpdateTime", Value: direction}, {Key: "name", Value: direction}}
+		if query.HasCursor {
+			filters = append(filters, bson.M{"$or": bson.A{
+				bson.M{"lastUpdateTime": bson.M{cmp: query.AfterLastUpdateTime}},
+				bson.M{"lastUpdateTime": query.AfterLastUpdateTime, "name": bson.M{cmp: query.AfterName}},
+			}})
+		}
+	default:
+		sort = bson.D{{Key: "name", Value: direction}}
+		if query.HasCursor {
+			filters = append(filters, bson.M{"name": bson.M{cmp: query.AfterName}})
+		}
+	}
+
+	filter := bson.M{}
+	if len(filters) != 0 {
+		filter = bson.M{"$and": filters}
+	}
+
+	return s.findRuleEngines(ctx, filter, options.Find().SetSort(sort).SetLimit(int64(query.Limit)))
 }
 
-func Close(ctx context.Context) error {
+// GetRuleEnginesUpdatedSince served by lastUpdateTime index
+func (s *mongoStore) GetRuleEnginesUpdatedSince(ctx context.Context, since int64) ([]*entities.RuleEngine, *entities.Error) {
+	return s.findRuleEngines(ctx, bson.M{"lastUpdateTime": bson.M{"$gte": since}})
+}
+
+// GetRuleEnginesScheduledBy served by nextScheduleTime index
+func (s *mongoStore) GetRuleEnginesScheduledBy(ctx context.Context, now int64) ([]*entities.RuleEngine, *entities.Error) {
+	return s.findRuleEngines(ctx, bson.M{"nextScheduleTime": bson.M{"$gt": 0, "$lte": now}})
+}
+
+func (s *mongoStore) findRuleEngines(ctx context.Context, filter interface{}, opts ...*options.FindOptions) ([]*entities.RuleEngine, *entities.Error) {
+	cursor, err := s.ruleEngineCollection.Find(ctx, filter, opts...)
+	if err != nil {
+		log.Logger.Error("Find RuleEngines failed", zap.String("Error", err.Error()))
+		return nil, entities.NewError(entities.ErrCodeDatastoreFailed)
+	}
+
+	ruleEngines := []*entities.RuleEngine{}
+	if err := cursor.All(ctx, &ruleEngines); err != nil {
+		log.Logger.Error("Decode RuleEngines failed", zap.String("Error", err.Error()))
+		return nil, entities.NewError(entities.ErrCodeDatastoreFailed)
+	}
+	return ruleEngines, nil
+}
+
+func (b *mongoBackend) view(ctx context.Context, fn func(tx) error) error {
+	return b.run(ctx, false, fn)
+}
+
+func (b *mongoBackend) update(ctx context.Context, fn func(tx) error) error {
+	return b.run(ctx, true, fn)
+}
+
+func (b *mongoBackend) close(ctx context.Context) error {
 	log.Logger.Info("Mongo client closing")
-	return client.Disconnect(ctx)
+	return b.client.Disconnect(ctx)
+}
+
+// run fn within session transaction, WithTransaction retries fn on transient transaction errors
+func (b *mongoBackend) run(ctx context.Context, writable bool, fn func(tx) error) error {
+	session, err := b.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(&mongoTx{ctx: sessCtx, backend: b, writable: writable})
+	})
+	return err
+}
+
+func (t *mongoTx) getRuleEngine(ruleEngineName string) (*entities.RuleEngine, error) {
+	var ruleEngine entities.RuleEngine
+	err := t.backend.ruleEngineCollection.FindOne(t.ctx, bson.M{"name": ruleEngineName}).Decode(&ruleEngine)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ruleEngine, nil
+}
+
+func (t *mongoTx) listRuleEngines() ([]*entities.RuleEngine, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := t.backend.ruleEngineCollection.Find(t.ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleEngines := []*entities.RuleEngine{}
+	if err := cursor.All(t.ctx, &ruleEngines); err != nil {
+		return nil, err
+	}
+	return ruleEngines, nil
+}
+
+func (t *mongoTx) putRuleEngine(ruleEngine *entities.RuleEngine) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	ruleEngine.Version++
+	opts := options.Replace().SetUpsert(true)
+	_, err := t.backend.ruleEngineCollection.ReplaceOne(t.ctx, bson.M{"name": ruleEngine.Name}, ruleEngine, opts)
+	return err
+}
+
+func (t *mongoTx) deleteRuleEngine(ruleEngineName string) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	_, err := t.backend.ruleEngineCollection.DeleteOne(t.ctx, bson.M{"name": ruleEngineName})
+	return err
+}
+
+func (t *mongoTx) getConfig(id primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error) {
+	var engineConfig entities.EngineConfig
+	err := t.backend.engineConfigCollection.FindOne(t.ctx, bson.M{"_id": id}).Decode(&engineConfig)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return engineConfig.EngineCoreConfig, nil
+}
+
+// config is considered immutable once stored
+func (t *mongoTx) putConfig(engineConfig *entities.EngineConfig) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	_, err := t.backend.engineConfigCollection.InsertOne(t.ctx, engineConfig)
+	return err
+}
+
+func (t *mongoTx) deleteConfig(id primitive.ObjectID) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	_, err := t.backend.engineConfigCollection.DeleteOne(t.ctx, bson.M{"_id": id})
+	return err
+}
+
+func (t *mongoTx) putShadowDisagreement(disagreement *entities.ShadowDisagreement) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	_, err := t.backend.shadowCollection.InsertOne(t.ctx, disagreement)
+	return err
+}
+
+func (t *mongoTx) listShadowDisagreements(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.ShadowDisagreement, error) {
+	disagreements := []*entities.ShadowDisagreement{}
+	if err := t.findNewestFirst(t.backend.shadowCollection, ruleEngineName, before, limit, &disagreements); err != nil {
+		return nil, err
+	}
+	return disagreements, nil
+}
+
+func (t *mongoTx) deleteShadowDisagreements(ruleEngineName string) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	_, err := t.backend.shadowCollection.DeleteMany(t.ctx, bson.M{"ruleEngine": ruleEngineName})
+	return err
+}
+
+func (t *mongoTx) putAuditEvent(event *entities.AuditEvent) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	_, err := t.backend.auditCollection.InsertOne(t.ctx, event)
+	return err
+}
+
+func (t *mongoTx) listAuditEvents(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.AuditEvent, error) {
+	events := []*entities.AuditEvent{}
+	if err := t.findNewestFirst(t.backend.auditCollection, ruleEngineName, before, limit, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (t *mongoTx) renameShadowDisagreements(ruleEngineName string, newRuleEngineName string) error {
+	return t.renameRecords(t.backend.shadowCollection, ruleEngineName, newRuleEngineName)
+}
+
+func (t *mongoTx) renameAuditEvents(ruleEngineName string, newRuleEngineName string) error {
+	return t.renameRecords(t.backend.auditCollection, ruleEngineName, newRuleEngineName)
+}
+
+// findNewestFirst decodes records of RuleEngine into result, served by ruleEngine and _id index
+func (t *mongoTx) findNewestFirst(coll *mongo.Collection, ruleEngineName string, before primitive.ObjectID, limit int, result interface{}) error {
+	filter := bson.M{"ruleEngine": ruleEngineName}
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := coll.Find(t.ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(t.ctx, result)
+}
+
+func (t *mongoTx) renameRecords(coll *mongo.Collection, ruleEngineName string, newRuleEngineName string) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	rename := bson.M{"$set": bson.M{"ruleEngine": newRuleEngineName}}
+	_, err := coll.UpdateMany(t.ctx, bson.M{"ruleEngine": ruleEngineName}, rename)
+	return err
 }
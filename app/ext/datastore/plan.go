@@ -0,0 +1,270 @@
+package datastore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// Declarative apply of RuleEngine, shared by every datastore. Plan is computed and executed within same transaction,
+// execution goes through tag invariants step by step so that applied RuleEngine is same as of equivalent API calls.
+
+// withKeptRouting is desired spec along with routing of RuleEngine(nil as not existing) kept as per options
+func withKeptRouting(ruleEngine *entities.RuleEngine, desired *entities.RuleEngineSpec, opts *entities.ApplyOptions) *entities.RuleEngineSpec {
+	spec := *desired
+	if ruleEngine == nil {
+		ruleEngine = &entities.RuleEngine{}
+	}
+	if opts.KeepAliases {
+		spec.Aliases = ruleEngine.Aliases
+	}
+	if opts.KeepTrafficSplit {
+		spec.TrafficSplit = ruleEngine.TrafficSplit
+	}
+	if opts.KeepShadowTag {
+		spec.ShadowTag = ruleEngine.ShadowTag
+	}
+	return &spec
+}
+
+// planOf changes making RuleEngine(nil as not existing) as desired. Steps are ordered such that each of them is allowed:
+// undeclared aliases deleted, tags created, configs of disabled tags updated, tags enabled, default set or removed,
+// aliases, traffic split and shadow tag set, tags disabled, configs of just disabled tags updated and undeclared tags deleted.
+// Config of tag which stays enabled is never updated, hence such plan fails on execution.
+func planOf(ruleEngine *entities.RuleEngine, desired *entities.RuleEngineSpec) ([]*entities.PlanStep, *entities.Error) {
+	tags := map[string]*entities.Tag{}
+	defaultTag := ""
+	current := &entities.RuleEngine{}
+	if ruleEngine != nil {
+		tags = ruleEngine.Tags
+		defaultTag = ruleEngine.DefaultTag
+		current = ruleEngine
+	}
+
+	var aliasDeletes, creates, updates, enables, defaults, routes, disables, lateUpdates, deletes []*entities.PlanStep
+	desiredTags := []string{}
+	for tag := range desired.Tags {
+		desiredTags = append(desiredTags, tag)
+	}
+	sort.Strings(desiredTags)
+
+	for _, tag := range desiredTags {
+		tagSpec := desired.Tags[tag]
+		configDigest, err := digest.Of(tagSpec.Config)
+		if err != nil {
+			log.Logger.Error("RuleEngineConfig digest failed", zap.String("Error", err.Error()))
+			return nil, entities.NewError(entities.ErrCodeDatastoreFailed)
+		}
+
+		t, ok := tags[tag]
+		if !ok {
+			creates = append(creates, &entities.PlanStep{Operation: entities.AuditOpCreateTag, Tag: tag, Digest: configDigest})
+			if tagSpec.IsEnable {
+				enables = append(enables, &entities.PlanStep{Operation: entities.AuditOpEnableTag, Tag: tag})
+			}
+			continue
+		}
+
+		if t.Digest != configDigest {
+			update := &entities.PlanStep{Operation: entities.AuditOpUpdateTagConfig, Tag: tag, Digest: configDigest}
+			if t.IsEnable {
+				lateUpdates = append(lateUpdates, update)
+			} else {
+				updates = append(updates, update)
+			}
+		}
+		if tagSpec.IsEnable && !t.IsEnable {
+			enables = append(enables, &entities.PlanStep{Operation: entities.AuditOpEnableTag, Tag: tag})
+		}
+		if !tagSpec.IsEnable && t.IsEnable {
+			disables = append(disables, &entities.PlanStep{Operation: entities.AuditOpDisableTag, Tag: tag})
+		}
+	}
+
+	undeclaredTags := []string{}
+	for tag := range tags {
+		if _, ok := desired.Tags[tag]; !ok {
+			undeclaredTags = append(undeclaredTags, tag)
+		}
+	}
+	sort.Strings(undeclaredTags)
+
+	for _, tag := range undeclaredTags {
+		if tags[tag].IsEnable {
+			disables = append(disables, &entities.PlanStep{Operation: entities.AuditOpDisableTag, Tag: tag})
+		}
+		deletes = append(deletes, &entities.PlanStep{Operation: entities.AuditOpDeleteTag, Tag: tag})
+	}
+
+	if desired.DefaultTag != defaultTag {
+		if desired.DefaultTag == "" {
+			defaults = append(defaults, &entities.PlanStep{Operation: entities.AuditOpRemoveDefaultTag})
+		} else {
+			defaults = append(defaults, &entities.PlanStep{Operation: entities.AuditOpSetDefaultTag, Tag: desired.DefaultTag})
+		}
+	}
+
+	aliases := []string{}
+	for alias := range current.Aliases {
+		if _, ok := desired.Aliases[alias]; !ok {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		aliasDeletes = append(aliasDeletes, &entities.PlanStep{Operation: entities.AuditOpDeleteAlias, Detail: alias})
+	}
+
+	aliases = []string{}
+	for alias, tag := range desired.Aliases {
+		if current.Aliases[alias] != tag {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		routes = append(routes, &entities.PlanStep{Operation: entities.AuditOpSetAlias, Tag: desired.Aliases[alias], Detail: alias})
+	}
+
+	if !sameTrafficSplit(current.TrafficSplit, desired.TrafficSplit) {
+		routes = append(routes, &entities.PlanStep{Operation: entities.AuditOpSetTrafficSplit, Detail: trafficSplitDetail(desired.TrafficSplit)})
+	}
+	if current.ShadowTag != desired.ShadowTag {
+		routes = append(routes, &entities.PlanStep{Operation: entities.AuditOpSetShadowTag, Tag: desired.ShadowTag})
+	}
+
+	steps := []*entities.PlanStep{}
+	for _, group := range [][]*entities.PlanStep{aliasDeletes, creates, updates, enables, defaults, routes, disables, lateUpdates, deletes} {
+		steps = append(steps, group...)
+	}
+	return steps, nil
+}
+
+// planWrites are config records to be written by caller along with RuleEngine
+type planWrites struct {
+	configs          []*entities.EngineConfig
+	deletedConfigIDs []primitive.ObjectID
+}
+
+// executePlan executes steps on RuleEngine(nil as not existing, created by first step), configs are taken from desired.
+// returns changed RuleEngine, config records to be written and audit event of every step.
+func executePlan(ctx context.Context, ruleEngine *entities.RuleEngine, desired *entities.RuleEngineSpec, steps []*entities.PlanStep) (*entities.RuleEngine, *planWrites, []*entities.AuditEvent, *entities.Error) {
+	writes := &planWrites{}
+	events := []*entities.AuditEvent{}
+	for _, step := range steps {
+		before := auditStateOf(ruleEngine, step.Tag)
+		var err *entities.Error
+		if ruleEngine, err = executeStep(ruleEngine, desired, step, writes); err != nil {
+			switch {
+			case step.Operation == entities.AuditOpSetAlias || step.Operation == entities.AuditOpDeleteAlias:
+				err = entities.NewErrorWithMsg(err.ErrCode, "alias:"+step.Detail)
+			case step.Tag != "":
+				err = entities.NewErrorWithMsg(err.ErrCode, "tag:"+step.Tag)
+			}
+			return nil, nil, nil, err
+		}
+		event := newAuditEvent(ctx, step.Operation, desired.Name, step.Tag, before, auditStateOf(ruleEngine, step.Tag))
+		event.Detail = step.Detail
+		events = append(events, event)
+	}
+
+	if ruleEngine != nil {
+		ruleEngine.LastUpdateTime = time.Now().Unix()
+	}
+	return ruleEngine, writes, events, nil
+}
+
+// executeStep on RuleEngine, returns RuleEngine as it is created by CreateTag in case of nil
+func executeStep(ruleEngine *entities.RuleEngine, desired *entities.RuleEngineSpec, step *entities.PlanStep, writes *planWrites) (*entities.RuleEngine, *entities.Error) {
+	var err *entities.Error
+	switch step.Operation {
+	case entities.AuditOpCreateTag:
+		if err := checkNewTag(ruleEngine, step.Tag); err != nil {
+			return nil, err
+		}
+		engineConfig := &entities.EngineConfig{ID: primitive.NewObjectID(), EngineCoreConfig: desired.Tags[step.Tag].Config}
+		writes.configs = append(writes.configs, engineConfig)
+		return addTag(ruleEngine, desired.Name, step.Tag, engineConfig.ID, step.Digest), nil
+
+	case entities.AuditOpUpdateTagConfig:
+		t := ruleEngine.Tags[step.Tag]
+		if t.IsEnable || ruleEngine.DefaultTag == step.Tag {
+			return nil, entities.NewError(entities.ErrCodeTagUpdateNotAllowed)
+		}
+		// new id, so that cached RuleEngine instances of old config are never reused
+		engineConfig := &entities.EngineConfig{ID: primitive.NewObjectID(), EngineCoreConfig: desired.Tags[step.Tag].Config}
+		writes.configs = append(writes.configs, engineConfig)
+		writes.deletedConfigIDs = append(writes.deletedConfigIDs, t.EngineConfigID)
+		t.EngineConfigID = engineConfig.ID
+		t.Digest = step.Digest
+
+	case entities.AuditOpEnableTag:
+		_, err = enableTag(ruleEngine, step.Tag)
+
+	case entities.AuditOpDisableTag:
+		_, err = disableTag(ruleEngine, step.Tag)
+
+	case entities.AuditOpSetDefaultTag:
+		err = setDefaultTag(ruleEngine, step.Tag)
+
+	case entities.AuditOpRemoveDefaultTag:
+		removeDefaultTag(ruleEngine)
+
+	case entities.AuditOpDeleteTag:
+		var t *entities.Tag
+		if t, err = deleteTag(ruleEngine, step.Tag); err == nil {
+			writes.deletedConfigIDs = append(writes.deletedConfigIDs, t.EngineConfigID)
+		}
+
+	case entities.AuditOpSetAlias:
+		err = setAlias(ruleEngine, step.Detail, step.Tag)
+
+	case entities.AuditOpDeleteAlias:
+		delete(ruleEngine.Aliases, step.Detail)
+
+	case entities.AuditOpSetTrafficSplit:
+		if len(desired.TrafficSplit) != 0 {
+			err = validateTrafficSplit(ruleEngine, desired.TrafficSplit)
+		}
+		ruleEngine.TrafficSplit = nil
+		for _, tw := range desired.TrafficSplit {
+			ruleEngine.TrafficSplit = append(ruleEngine.TrafficSplit, &entities.TagWeight{Tag: tw.Tag, Weight: tw.Weight})
+		}
+
+	case entities.AuditOpSetShadowTag:
+		err = setShadowTag(ruleEngine, step.Tag)
+
+	default:
+		log.Logger.Error("Unknown plan step", zap.String("Operation", step.Operation))
+		return nil, entities.NewError(entities.ErrCodeDatastoreFailed)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return ruleEngine, nil
+}
+
+// sameTrafficSplit compares tags and weights of splits, i.e. order of tags is irrelevant
+func sameTrafficSplit(split []*entities.TagWeight, other []*entities.TagWeight) bool {
+	if len(split) != len(other) {
+		return false
+	}
+
+	weights := map[string]uint{}
+	for _, tw := range split {
+		weights[tw.Tag] = tw.Weight
+	}
+	for _, tw := range other {
+		if weight, ok := weights[tw.Tag]; !ok || weight != tw.Weight {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,273 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// testPlanRuleEngine has enabled default v1, enabled v2 aliased as stable and disabled v3, every tag of testConfig
+func testPlanRuleEngine(t *testing.T) *entities.RuleEngine {
+	t.Helper()
+	configDigest, err := digest.Of(testConfig(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ruleEngine := &entities.RuleEngine{Name: "shop", DefaultTag: "v1", Tags: map[string]*entities.Tag{}, Aliases: map[string]string{"stable": "v2"}}
+	for _, tag := range []string{"v1", "v2", "v3"} {
+		ruleEngine.Tags[tag] = &entities.Tag{Name: tag, EngineConfigID: primitive.NewObjectID(), IsEnable: tag != "v3", Digest: configDigest}
+	}
+	return ruleEngine
+}
+
+// testPlanSpec is desired state matching testPlanRuleEngine
+func testPlanSpec(t *testing.T) *entities.RuleEngineSpec {
+	t.Helper()
+	return &entities.RuleEngineSpec{
+		Name:       "shop",
+		DefaultTag: "v1",
+		Tags: map[string]*entities.TagSpec{
+			"v1": {IsEnable: true, Config: testConfig(t)},
+			"v2": {IsEnable: true, Config: testConfig(t)},
+			"v3": {IsEnable: false, Config: testConfig(t)},
+		},
+		Aliases: map[string]string{"stable": "v2"},
+	}
+}
+
+// stepsOf as operation:tag:detail, so that plans are compared irrespective of digest
+func stepsOf(steps []*entities.PlanStep) []string {
+	result := []string{}
+	for _, step := range steps {
+		result = append(result, fmt.Sprintf("%v:%v:%v", step.Operation, step.Tag, step.Detail))
+	}
+	return result
+}
+
+func TestPlanOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+		modify   func(*entities.RuleEngineSpec)
+		want     []string
+		wantErr  uint
+	}{
+		{
+			name:     "in sync",
+			existing: true,
+			modify:   func(*entities.RuleEngineSpec) {},
+			want:     []string{},
+		},
+		{
+			name:   "new RuleEngine",
+			modify: func(*entities.RuleEngineSpec) {},
+			want: []string{
+				"CreateTag:v1:", "CreateTag:v2:", "CreateTag:v3:",
+				"EnableTag:v1:", "EnableTag:v2:",
+				"SetDefaultTag:v1:",
+				"SetAlias:v2:stable",
+			},
+		},
+		{
+			name:     "config of disabled tag updated before enable",
+			existing: true,
+			modify: func(s *entities.RuleEngineSpec) {
+				s.Tags["v3"] = &entities.TagSpec{IsEnable: true, Config: changedTestConfig(t)}
+			},
+			want: []string{"UpdateTagConfig:v3:", "EnableTag:v3:"},
+		},
+		{
+			name:     "config of disabled tag updated after disable",
+			existing: true,
+			modify: func(s *entities.RuleEngineSpec) {
+				s.Aliases = nil
+				s.Tags["v2"] = &entities.TagSpec{IsEnable: false, Config: changedTestConfig(t)}
+			},
+			want: []string{"DeleteAlias::stable", "DisableTag:v2:", "UpdateTagConfig:v2:"},
+		},
+		{
+			name:     "config of tag which stays enabled fails",
+			existing: true,
+			modify:   func(s *entities.RuleEngineSpec) { s.Tags["v1"].Config = changedTestConfig(t) },
+			want:     []string{"UpdateTagConfig:v1:"},
+			wantErr:  entities.ErrCodeTagUpdateNotAllowed,
+		},
+		{
+			name:     "default moved and undeclared tags dropped",
+			existing: true,
+			modify: func(s *entities.RuleEngineSpec) {
+				s.DefaultTag = "v2"
+				delete(s.Tags, "v1")
+				delete(s.Tags, "v3")
+			},
+			want: []string{"SetDefaultTag:v2:", "DisableTag:v1:", "DeleteTag:v1:", "DeleteTag:v3:"},
+		},
+		{
+			name:     "default removed",
+			existing: true,
+			modify:   func(s *entities.RuleEngineSpec) { s.DefaultTag = "" },
+			want:     []string{"RemoveDefaultTag::"},
+		},
+		{
+			name:     "routing set",
+			existing: true,
+			modify: func(s *entities.RuleEngineSpec) {
+				s.Tags["v3"].IsEnable = true
+				s.Aliases = map[string]string{"stable": "v1", "canary": "v3"}
+				s.TrafficSplit = []*entities.TagWeight{{Tag: "v1", Weight: 90}, {Tag: "v3", Weight: 10}}
+				s.ShadowTag = "v3"
+			},
+			want: []string{"EnableTag:v3:", "SetAlias:v3:canary", "SetAlias:v1:stable", "SetTrafficSplit::v1:90,v3:10", "SetShadowTag:v3:"},
+		},
+		{
+			name:     "undeclared tag still aliased fails",
+			existing: true,
+			modify:   func(s *entities.RuleEngineSpec) { delete(s.Tags, "v2") },
+			want:     []string{"DisableTag:v2:", "DeleteTag:v2:"},
+			wantErr:  entities.ErrCodeTagDisableNotAllowed,
+		},
+		{
+			name:     "alias of disabled tag fails",
+			existing: true,
+			modify:   func(s *entities.RuleEngineSpec) { s.Aliases["old"] = "v3" },
+			want:     []string{"SetAlias:v3:old"},
+			wantErr:  entities.ErrCodeAliasTagMustBeEnabled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log.Logger = zap.NewNop()
+			var ruleEngine *entities.RuleEngine
+			if tt.existing {
+				ruleEngine = testPlanRuleEngine(t)
+			}
+			desired := testPlanSpec(t)
+			tt.modify(desired)
+
+			steps, err := planOf(ruleEngine, desired)
+			if err != nil {
+				t.Fatalf("planOf() error = %v", err)
+			}
+			if got := stepsOf(steps); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("planOf() = %v, want %v", got, tt.want)
+			}
+
+			applied, _, events, err := executePlan(context.Background(), ruleEngine, desired, steps)
+			if errCodeOf(err) != tt.wantErr {
+				t.Fatalf("executePlan() error = %v, want errCode %v", err, tt.wantErr)
+			}
+			if tt.wantErr != 0 || len(steps) == 0 {
+				return
+			}
+			if len(events) != len(steps) {
+				t.Errorf("audited %v events for %v steps", len(events), len(steps))
+			}
+
+			// executed plan leaves nothing to do
+			if again, err := planOf(applied, desired); err != nil || len(again) != 0 {
+				t.Errorf("planOf() after execution = %v, %v, want none", stepsOf(again), err)
+			}
+		})
+	}
+}
+
+func TestExecutePlanWrites(t *testing.T) {
+	log.Logger = zap.NewNop()
+	ruleEngine := testPlanRuleEngine(t)
+	v3ConfigID := ruleEngine.Tags["v3"].EngineConfigID
+	desired := testPlanSpec(t)
+	desired.Tags["v3"] = &entities.TagSpec{Config: changedTestConfig(t)}
+	desired.Tags["v4"] = &entities.TagSpec{Config: testConfig(t)}
+
+	steps, err := planOf(ruleEngine, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, writes, _, err := executePlan(context.Background(), ruleEngine, desired, steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// updated config is written as a fresh record, so that cached instances of old config are never reused
+	if len(writes.configs) != 2 || !reflect.DeepEqual(writes.deletedConfigIDs, []primitive.ObjectID{v3ConfigID}) {
+		t.Fatalf("writes %v configs, deleted %v", len(writes.configs), writes.deletedConfigIDs)
+	}
+	for _, engineConfig := range writes.configs {
+		if engineConfig.ID == v3ConfigID {
+			t.Errorf("config record %v reused", v3ConfigID)
+		}
+	}
+	if applied.Tags["v3"].EngineConfigID == v3ConfigID || applied.Tags["v4"] == nil || applied.Tags["v4"].IsEnable {
+		t.Errorf("unexpected tags %+v, %+v", applied.Tags["v3"], applied.Tags["v4"])
+	}
+}
+
+func TestWithKeptRouting(t *testing.T) {
+	ruleEngine := &entities.RuleEngine{
+		Aliases:      map[string]string{"stable": "v1"},
+		TrafficSplit: []*entities.TagWeight{{Tag: "v1", Weight: 100}},
+		ShadowTag:    "v2",
+	}
+	desired := &entities.RuleEngineSpec{Name: "shop", Aliases: map[string]string{"canary": "v2"}}
+
+	tests := []struct {
+		name       string
+		ruleEngine *entities.RuleEngine
+		opts       *entities.ApplyOptions
+		want       *entities.RuleEngineSpec
+	}{
+		{"nothing kept", ruleEngine, &entities.ApplyOptions{}, desired},
+		{
+			name:       "everything kept",
+			ruleEngine: ruleEngine,
+			opts:       &entities.ApplyOptions{KeepAliases: true, KeepTrafficSplit: true, KeepShadowTag: true},
+			want:       &entities.RuleEngineSpec{Name: "shop", Aliases: ruleEngine.Aliases, TrafficSplit: ruleEngine.TrafficSplit, ShadowTag: "v2"},
+		},
+		{
+			name:       "new RuleEngine",
+			ruleEngine: nil,
+			opts:       &entities.ApplyOptions{KeepAliases: true, KeepTrafficSplit: true, KeepShadowTag: true},
+			want:       &entities.RuleEngineSpec{Name: "shop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withKeptRouting(tt.ruleEngine, desired, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withKeptRouting() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if len(desired.Aliases) != 1 || desired.Aliases["canary"] != "v2" {
+		t.Errorf("desired modified, aliases %v", desired.Aliases)
+	}
+}
+
+func TestSameTrafficSplit(t *testing.T) {
+	split := []*entities.TagWeight{{Tag: "v1", Weight: 90}, {Tag: "v2", Weight: 10}}
+	tests := []struct {
+		name  string
+		other []*entities.TagWeight
+		want  bool
+	}{
+		{"same", []*entities.TagWeight{{Tag: "v1", Weight: 90}, {Tag: "v2", Weight: 10}}, true},
+		{"reordered", []*entities.TagWeight{{Tag: "v2", Weight: 10}, {Tag: "v1", Weight: 90}}, true},
+		{"weight changed", []*entities.TagWeight{{Tag: "v1", Weight: 80}, {Tag: "v2", Weight: 20}}, false},
+		{"tag changed", []*entities.TagWeight{{Tag: "v1", Weight: 90}, {Tag: "v3", Weight: 10}}, false},
+		{"removed", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameTrafficSplit(split, tt.other); got != tt.want {
+				t.Errorf("sameTrafficSplit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,523 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+const (
+	// serialization failure and deadlock are retried, similar to mongo WithTransaction
+	pgTxnMaxAttempts = 3
+
+	// guards concurrent migrations from multiple replicas
+	pgMigrationLockID = 7305652
+)
+
+//go:embed migrations/postgres/*.sql
+var pgMigrations embed.FS
+
+// postgresBackend persists records in PostgreSQL, RuleEngineConfig is stored as JSONB.
+// Read-write transactions run with serializable isolation.
+type postgresBackend struct {
+	db *sql.DB
+}
+
+type postgresTx struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+func newPostgresStore(conf *config.PostgresConf) (*txnStore, error) {
+	db, err := sql.Open("postgres", conf.Url)
+	if err != nil {
+		log.Logger.Error("Postgres open failed", zap.String("error", err.Error()))
+		return nil, err
+	}
+
+	pingCtx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		log.Logger.Error("Postgres ping failed", zap.String("error", err.Error()))
+		db.Close()
+		return nil, err
+	}
+
+	if err := migratePostgres(context.TODO(), db); err != nil {
+		log.Logger.Error("Postgres migration failed", zap.String("error", err.Error()))
+		db.Close()
+		return nil, err
+	}
+
+	store := &txnStore{backend: &postgresBackend{db: db}}
+	if err := store.backfillDigests(context.TODO()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// migratePostgres applies pending versioned migrations in order, version is the numeric prefix of migration file name.
+func migratePostgres(ctx context.Context, db *sql.DB) error {
+	files, err := fs.Glob(pgMigrations, "migrations/postgres/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", pgMigrationLockID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INT PRIMARY KEY,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name := file[strings.LastIndex(file, "/")+1:]
+		version, err := strconv.Atoi(strings.SplitN(name, "_", 2)[0])
+		if err != nil {
+			return fmt.Errorf("invalid migration file name %v: %w", name, err)
+		}
+
+		var applied bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&applied); err != nil {
+			return err
+		}
+		if applied {
+			continue
+		}
+
+		migration, err := pgMigrations.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(migration)); err != nil {
+			return fmt.Errorf("migration %v failed: %w", name, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)", version, time.Now().Unix()); err != nil {
+			return err
+		}
+		log.Logger.Info("Postgres migration applied", zap.String("Migration", name))
+	}
+
+	return tx.Commit()
+}
+
+func (b *postgresBackend) view(ctx context.Context, fn func(tx) error) error {
+	return b.run(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, fn)
+}
+
+func (b *postgresBackend) update(ctx context.Context, fn func(tx) error) error {
+	return b.run(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}, fn)
+}
+
+func (b *postgresBackend) close(ctx context.Context) error {
+	log.Logger.Info("Postgres client closing")
+	return b.db.Close()
+}
+
+func (b *postgresBackend) run(ctx context.Context, opts *sql.TxOptions, fn func(tx) error) error {
+	var err error
+	for attempt := 1; attempt <= pgTxnMaxAttempts; attempt++ {
+		if err = b.runOnce(ctx, opts, fn); !isPgRetryable(err) {
+			return err
+		}
+		log.Logger.Warn("Postgres transaction conflict, retrying", zap.Int("Attempt", attempt), zap.String("error", err.Error()))
+	}
+	return err
+}
+
+func (b *postgresBackend) runOnce(ctx context.Context, opts *sql.TxOptions, fn func(tx) error) error {
+	sqlTx, err := b.db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&postgresTx{ctx: ctx, tx: sqlTx}); err != nil {
+		sqlTx.Rollback()
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+func isPgRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// serialization_failure, deadlock_detected
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
+
+func (t *postgresTx) getRuleEngine(ruleEngineName string) (*entities.RuleEngine, error) {
+	ruleEngine := entities.RuleEngine{Tags: map[string]*entities.Tag{}, Aliases: map[string]string{}}
+	var incarnation string
+	var trafficSplit, defaultTagHistory []byte
+	err := t.tx.QueryRowContext(t.ctx, "SELECT name, default_tag, last_update_time, version, incarnation, traffic_split, shadow_tag, next_schedule_time, default_tag_history FROM ruleengine WHERE name = $1", ruleEngineName).
+		Scan(&ruleEngine.Name, &ruleEngine.DefaultTag, &ruleEngine.LastUpdateTime, &ruleEngine.Version, &incarnation, &trafficSplit, &ruleEngine.ShadowTag, &ruleEngine.NextScheduleTime, &defaultTagHistory)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ruleEngine.Incarnation, err = incarnationOf(incarnation); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(trafficSplit, &ruleEngine.TrafficSplit); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(defaultTagHistory, &ruleEngine.DefaultTagHistory); err != nil {
+		return nil, err
+	}
+
+	ruleEngines := map[string]*entities.RuleEngine{ruleEngine.Name: &ruleEngine}
+	if err := t.loadTags(ruleEngines, "WHERE ruleengine_name = $1", ruleEngineName); err != nil {
+		return nil, err
+	}
+	if err := t.loadAliases(ruleEngines, "WHERE ruleengine_name = $1", ruleEngineName); err != nil {
+		return nil, err
+	}
+	return &ruleEngine, nil
+}
+
+func (t *postgresTx) listRuleEngines() ([]*entities.RuleEngine, error) {
+	rows, err := t.tx.QueryContext(t.ctx, "SELECT name, default_tag, last_update_time, version, incarnation, traffic_split, shadow_tag, next_schedule_time, default_tag_history FROM ruleengine ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*entities.RuleEngine{}
+	ruleEngines := map[string]*entities.RuleEngine{}
+	for rows.Next() {
+		ruleEngine := entities.RuleEngine{Tags: map[string]*entities.Tag{}, Aliases: map[string]string{}}
+		var incarnation string
+		var trafficSplit, defaultTagHistory []byte
+		if err := rows.Scan(&ruleEngine.Name, &ruleEngine.DefaultTag, &ruleEngine.LastUpdateTime, &ruleEngine.Version, &incarnation, &trafficSplit, &ruleEngine.ShadowTag, &ruleEngine.NextScheduleTime, &defaultTagHistory); err != nil {
+			return nil, err
+		}
+		if ruleEngine.Incarnation, err = incarnationOf(incarnation); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(trafficSplit, &ruleEngine.TrafficSplit); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(defaultTagHistory, &ruleEngine.DefaultTagHistory); err != nil {
+			return nil, err
+		}
+		result = append(result, &ruleEngine)
+		ruleEngines[ruleEngine.Name] = &ruleEngine
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := t.loadTags(ruleEngines, ""); err != nil {
+		return nil, err
+	}
+	if err := t.loadAliases(ruleEngines, ""); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// loadTags loads tags matching where clause into respective RuleEngine
+func (t *postgresTx) loadTags(ruleEngines map[string]*entities.RuleEngine, where string, args ...any) error {
+	rows, err := t.tx.QueryContext(t.ctx, "SELECT ruleengine_name, name, engine_config_id, is_enable, digest, activate_at, expire_at, previous_default_tag FROM ruleenginetag "+where, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ruleEngineName, engineConfigID string
+		var tag entities.Tag
+		if err := rows.Scan(&ruleEngineName, &tag.Name, &engineConfigID, &tag.IsEnable, &tag.Digest, &tag.ActivateAt, &tag.ExpireAt, &tag.PreviousDefaultTag); err != nil {
+			return err
+		}
+		if tag.EngineConfigID, err = primitive.ObjectIDFromHex(engineConfigID); err != nil {
+			return err
+		}
+		if ruleEngine, ok := ruleEngines[ruleEngineName]; ok {
+			ruleEngine.Tags[tag.Name] = &tag
+		}
+	}
+	return rows.Err()
+}
+
+// loadAliases loads aliases matching where clause into respective RuleEngine
+func (t *postgresTx) loadAliases(ruleEngines map[string]*entities.RuleEngine, where string, args ...any) error {
+	rows, err := t.tx.QueryContext(t.ctx, "SELECT ruleengine_name, name, tag FROM ruleenginealias "+where, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ruleEngineName, alias, tag string
+		if err := rows.Scan(&ruleEngineName, &alias, &tag); err != nil {
+			return err
+		}
+		if ruleEngine, ok := ruleEngines[ruleEngineName]; ok {
+			ruleEngine.Aliases[alias] = tag
+		}
+	}
+	return rows.Err()
+}
+
+func (t *postgresTx) putRuleEngine(ruleEngine *entities.RuleEngine) error {
+	trafficSplit := ruleEngine.TrafficSplit
+	if trafficSplit == nil {
+		trafficSplit = []*entities.TagWeight{}
+	}
+	data, err := json.Marshal(trafficSplit)
+	if err != nil {
+		return err
+	}
+	defaultTagHistory := ruleEngine.DefaultTagHistory
+	if defaultTagHistory == nil {
+		defaultTagHistory = []string{}
+	}
+	history, err := json.Marshal(defaultTagHistory)
+	if err != nil {
+		return err
+	}
+
+	incarnation := ""
+	if !ruleEngine.Incarnation.IsZero() {
+		incarnation = ruleEngine.Incarnation.Hex()
+	}
+
+	ruleEngine.Version++
+	_, err = t.tx.ExecContext(t.ctx, `INSERT INTO ruleengine (name, default_tag, last_update_time, version, incarnation, traffic_split, shadow_tag, next_schedule_time, default_tag_history)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (name) DO UPDATE SET default_tag = EXCLUDED.default_tag, last_update_time = EXCLUDED.last_update_time, version = EXCLUDED.version,
+		incarnation = EXCLUDED.incarnation, traffic_split = EXCLUDED.traffic_split, shadow_tag = EXCLUDED.shadow_tag,
+		next_schedule_time = EXCLUDED.next_schedule_time, default_tag_history = EXCLUDED.default_tag_history`,
+		ruleEngine.Name, ruleEngine.DefaultTag, ruleEngine.LastUpdateTime, ruleEngine.Version, incarnation, string(data), ruleEngine.ShadowTag, ruleEngine.NextScheduleTime, string(history))
+	if err != nil {
+		return err
+	}
+
+	// only changed tag and alias rows are written, compared against stored rows
+	stored := map[string]*entities.RuleEngine{ruleEngine.Name: {Tags: map[string]*entities.Tag{}, Aliases: map[string]string{}}}
+	if err := t.loadTags(stored, "WHERE ruleengine_name = $1", ruleEngine.Name); err != nil {
+		return err
+	}
+	if err := t.loadAliases(stored, "WHERE ruleengine_name = $1", ruleEngine.Name); err != nil {
+		return err
+	}
+	storedTags, storedAliases := stored[ruleEngine.Name].Tags, stored[ruleEngine.Name].Aliases
+
+	for name := range storedTags {
+		if _, ok := ruleEngine.Tags[name]; ok {
+			continue
+		}
+		if _, err := t.tx.ExecContext(t.ctx, "DELETE FROM ruleenginetag WHERE ruleengine_name = $1 AND name = $2", ruleEngine.Name, name); err != nil {
+			return err
+		}
+	}
+
+	for name, tag := range ruleEngine.Tags {
+		if storedTag, ok := storedTags[name]; ok && *storedTag == *tag {
+			continue
+		}
+		_, err := t.tx.ExecContext(t.ctx, `INSERT INTO ruleenginetag (ruleengine_name, name, engine_config_id, is_enable, digest, activate_at, expire_at, previous_default_tag)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (ruleengine_name, name) DO UPDATE SET engine_config_id = EXCLUDED.engine_config_id, is_enable = EXCLUDED.is_enable,
+			digest = EXCLUDED.digest, activate_at = EXCLUDED.activate_at, expire_at = EXCLUDED.expire_at, previous_default_tag = EXCLUDED.previous_default_tag`,
+			ruleEngine.Name, name, tag.EngineConfigID.Hex(), tag.IsEnable, tag.Digest, tag.ActivateAt, tag.ExpireAt, tag.PreviousDefaultTag)
+		if err != nil {
+			return err
+		}
+	}
+
+	for alias := range storedAliases {
+		if _, ok := ruleEngine.Aliases[alias]; ok {
+			continue
+		}
+		if _, err := t.tx.ExecContext(t.ctx, "DELETE FROM ruleenginealias WHERE ruleengine_name = $1 AND name = $2", ruleEngine.Name, alias); err != nil {
+			return err
+		}
+	}
+
+	for alias, tag := range ruleEngine.Aliases {
+		if storedTag, ok := storedAliases[alias]; ok && storedTag == tag {
+			continue
+		}
+		_, err := t.tx.ExecContext(t.ctx, `INSERT INTO ruleenginealias (ruleengine_name, name, tag) VALUES ($1, $2, $3)
+			ON CONFLICT (ruleengine_name, name) DO UPDATE SET tag = EXCLUDED.tag`, ruleEngine.Name, alias, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// incarnationOf stored ObjectID hex, empty for RuleEngines stored before incarnations
+func incarnationOf(hex string) (primitive.ObjectID, error) {
+	if hex == "" {
+		return primitive.NilObjectID, nil
+	}
+	return primitive.ObjectIDFromHex(hex)
+}
+
+func (t *postgresTx) deleteRuleEngine(ruleEngineName string) error {
+	_, err := t.tx.ExecContext(t.ctx, "DELETE FROM ruleengine WHERE name = $1", ruleEngineName)
+	return err
+}
+
+func (t *postgresTx) getConfig(id primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error) {
+	var data []byte
+	err := t.tx.QueryRowContext(t.ctx, "SELECT config FROM ruleengineconfig WHERE id = $1", id.Hex()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config ruleenginecore.RuleEngineConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (t *postgresTx) putConfig(engineConfig *entities.EngineConfig) error {
+	data, err := json.Marshal(engineConfig.EngineCoreConfig)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.tx.ExecContext(t.ctx, `INSERT INTO ruleengineconfig (id, config) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET config = EXCLUDED.config`, engineConfig.ID.Hex(), string(data))
+	return err
+}
+
+func (t *postgresTx) deleteConfig(id primitive.ObjectID) error {
+	_, err := t.tx.ExecContext(t.ctx, "DELETE FROM ruleengineconfig WHERE id = $1", id.Hex())
+	return err
+}
+
+func (t *postgresTx) putShadowDisagreement(disagreement *entities.ShadowDisagreement) error {
+	data, err := json.Marshal(disagreement)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.tx.ExecContext(t.ctx, "INSERT INTO shadowdisagreement (id, ruleengine_name, disagreement) VALUES ($1, $2, $3)",
+		disagreement.ID.Hex(), disagreement.RuleEngine, string(data))
+	return err
+}
+
+func (t *postgresTx) listShadowDisagreements(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.ShadowDisagreement, error) {
+	beforeID := ""
+	if !before.IsZero() {
+		beforeID = before.Hex()
+	}
+
+	rows, err := t.tx.QueryContext(t.ctx, `SELECT disagreement FROM shadowdisagreement
+		WHERE ruleengine_name = $1 AND ($2 = '' OR id < $2) ORDER BY id DESC LIMIT $3`, ruleEngineName, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	disagreements := []*entities.ShadowDisagreement{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var disagreement entities.ShadowDisagreement
+		if err := json.Unmarshal(data, &disagreement); err != nil {
+			return nil, err
+		}
+		disagreements = append(disagreements, &disagreement)
+	}
+	return disagreements, rows.Err()
+}
+
+func (t *postgresTx) deleteShadowDisagreements(ruleEngineName string) error {
+	_, err := t.tx.ExecContext(t.ctx, "DELETE FROM shadowdisagreement WHERE ruleengine_name = $1", ruleEngineName)
+	return err
+}
+
+func (t *postgresTx) renameShadowDisagreements(ruleEngineName string, newRuleEngineName string) error {
+	_, err := t.tx.ExecContext(t.ctx, `UPDATE shadowdisagreement SET ruleengine_name = $2,
+		disagreement = jsonb_set(disagreement, '{ruleEngine}', to_jsonb($2::text)) WHERE ruleengine_name = $1`, ruleEngineName, newRuleEngineName)
+	return err
+}
+
+func (t *postgresTx) renameAuditEvents(ruleEngineName string, newRuleEngineName string) error {
+	_, err := t.tx.ExecContext(t.ctx, `UPDATE auditevent SET ruleengine_name = $2,
+		event = jsonb_set(event, '{ruleEngine}', to_jsonb($2::text)) WHERE ruleengine_name = $1`, ruleEngineName, newRuleEngineName)
+	return err
+}
+
+func (t *postgresTx) putAuditEvent(event *entities.AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.tx.ExecContext(t.ctx, "INSERT INTO auditevent (id, ruleengine_name, event) VALUES ($1, $2, $3)",
+		event.ID.Hex(), event.RuleEngine, string(data))
+	return err
+}
+
+func (t *postgresTx) listAuditEvents(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.AuditEvent, error) {
+	beforeID := ""
+	if !before.IsZero() {
+		beforeID = before.Hex()
+	}
+
+	rows, err := t.tx.QueryContext(t.ctx, `SELECT event FROM auditevent
+		WHERE ruleengine_name = $1 AND ($2 = '' OR id < $2) ORDER BY id DESC LIMIT $3`, ruleEngineName, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*entities.AuditEvent{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var event entities.AuditEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
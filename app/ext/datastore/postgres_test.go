@@ -0,0 +1,248 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// integration tests run against database of given connection string, skipped if not set
+const postgresTestUrlEnv = "RULEENGINE_TEST_POSTGRES_URL"
+
+const testConfigJSON = `{"fields":{"amount":"int"},"conditionTypes":{"big":{"operator":">","operandType":"int","operands":[{"operandAs":"field","val":"amount"},{"operandAs":"constant","val":"100"}]}},"rules":{"r1":{"priority":1,"condition":{"conditionType":"big"},"result":{"discount":10}}}}`
+
+func testConfig(t *testing.T) *ruleenginecore.RuleEngineConfig {
+	t.Helper()
+	var config ruleenginecore.RuleEngineConfig
+	if err := json.Unmarshal([]byte(testConfigJSON), &config); err != nil {
+		t.Fatalf("test config unmarshal failed: %v", err)
+	}
+	return &config
+}
+
+func newTestPostgresStore(t *testing.T) *txnStore {
+	t.Helper()
+	url := os.Getenv(postgresTestUrlEnv)
+	if url == "" {
+		t.Skipf("%v not set", postgresTestUrlEnv)
+	}
+	log.Logger = zap.NewNop()
+
+	store, err := newPostgresStore(&config.PostgresConf{Url: url})
+	if err != nil {
+		t.Fatalf("postgres store creation failed: %v", err)
+	}
+	t.Cleanup(func() { store.Close(context.Background()) })
+	return store
+}
+
+// unique RuleEngine name per test, so that tests are not affected by records of earlier runs
+func testRuleEngineName() string {
+	return "t" + primitive.NewObjectID().Hex()[12:]
+}
+
+func TestIsPgRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pq.Error{Code: "40001"}, true},
+		{"deadlock", &pq.Error{Code: "40P01"}, true},
+		{"wrapped serialization failure", fmt.Errorf("commit failed: %w", &pq.Error{Code: "40001"}), true},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"not pq error", errors.New("failed"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPgRetryable(tt.err); got != tt.want {
+				t.Errorf("isPgRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresMigrationConcurrent(t *testing.T) {
+	store := newTestPostgresStore(t)
+	db := store.backend.(*postgresBackend).db
+
+	// advisory lock serializes replicas, every migration is applied once
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = migratePostgres(context.Background(), db)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("migration %v failed: %v", i, err)
+		}
+	}
+
+	files, _ := pgMigrations.ReadDir("migrations/postgres")
+	var applied int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(files) {
+		t.Errorf("applied migrations = %v, want %v", applied, len(files))
+	}
+}
+
+func TestPostgresRuleEngine(t *testing.T) {
+	store := newTestPostgresStore(t)
+	ctx := context.Background()
+	name := testRuleEngineName()
+	t.Cleanup(func() { store.DeleteRuleEngine(ctx, name) })
+
+	steps := []struct {
+		name string
+		run  func() *entities.Error
+	}{
+		{"create", func() *entities.Error { return store.CreateRuleEngine(ctx, name, "v1", testConfig(t)) }},
+		{"create second tag", func() *entities.Error { return store.CreateRuleEngine(ctx, name, "v2", testConfig(t)) }},
+		{"enable", func() *entities.Error { return store.EnableTag(ctx, name, "v1") }},
+		{"set default", func() *entities.Error { return store.SetDefaultTag(ctx, name, "v1") }},
+		{"set alias", func() *entities.Error { return store.SetAlias(ctx, name, "stable", "v1") }},
+		{"set traffic split", func() *entities.Error {
+			return store.SetTrafficSplit(ctx, name, []*entities.TagWeight{{Tag: "v1", Weight: 100}})
+		}},
+		{"delete tag", func() *entities.Error { return store.DeleteRuleEngineConfig(ctx, name, "v2") }},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%v failed: %v", step.name, err)
+		}
+	}
+
+	ruleEngine, err := store.GetRuleEngine(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ruleEngine.DefaultTag != "v1" || ruleEngine.Aliases["stable"] != "v1" || len(ruleEngine.TrafficSplit) != 1 {
+		t.Errorf("unexpected routing, default %v, aliases %v, split %v", ruleEngine.DefaultTag, ruleEngine.Aliases, ruleEngine.TrafficSplit)
+	}
+	if len(ruleEngine.Tags) != 1 || !ruleEngine.Tags["v1"].IsEnable || ruleEngine.Tags["v1"].Digest == "" {
+		t.Errorf("unexpected tags %+v", ruleEngine.Tags)
+	}
+	if ruleEngine.Version < int64(len(steps)) {
+		t.Errorf("version = %v, want at least %v", ruleEngine.Version, len(steps))
+	}
+
+	_, config, err := store.GetTagConfig(ctx, name, "stable")
+	if err != nil || config == nil {
+		t.Errorf("GetTagConfig() by alias = %v, %v", config, err)
+	}
+}
+
+// concurrent writes on same RuleEngine conflict under serializable isolation, conflict is retried
+func TestPostgresConcurrentWrites(t *testing.T) {
+	store := newTestPostgresStore(t)
+	ctx := context.Background()
+	name := testRuleEngineName()
+	t.Cleanup(func() { store.DeleteRuleEngine(ctx, name) })
+
+	tags := []string{"a", "b", "c"}
+	for _, tag := range tags {
+		if err := store.CreateRuleEngine(ctx, name, tag, testConfig(t)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]*entities.Error, len(tags))
+	for i, tag := range tags {
+		wg.Add(1)
+		go func(i int, tag string) {
+			defer wg.Done()
+			errs[i] = store.EnableTag(ctx, name, tag)
+		}(i, tag)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+
+	ruleEngine, err := store.GetRuleEngine(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := 0
+	for _, tag := range ruleEngine.Tags {
+		if tag.IsEnable {
+			enabled++
+		}
+	}
+	// retries are bounded, every write is either applied or reported
+	if enabled+failed != len(tags) {
+		t.Errorf("enabled %v and failed %v, want %v in total", enabled, failed, len(tags))
+	}
+}
+
+func TestPostgresPutRuleEngineWritesChangedRows(t *testing.T) {
+	store := newTestPostgresStore(t)
+	ctx := context.Background()
+	name := testRuleEngineName()
+	t.Cleanup(func() { store.DeleteRuleEngine(ctx, name) })
+
+	for _, tag := range []string{"v1", "v2"} {
+		if err := store.CreateRuleEngine(ctx, name, tag, testConfig(t)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetAlias(ctx, name, "old", "v2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// rows of unchanged tag keep their physical location, i.e. they are not rewritten
+	db := store.backend.(*postgresBackend).db
+	ctidOf := func(tag string) string {
+		var ctid string
+		if err := db.QueryRow("SELECT ctid::text FROM ruleenginetag WHERE ruleengine_name = $1 AND name = $2", name, tag).Scan(&ctid); err != nil && err != sql.ErrNoRows {
+			t.Fatal(err)
+		}
+		return ctid
+	}
+	before := ctidOf("v2")
+
+	if err := store.EnableTag(ctx, name, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteAlias(ctx, name, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := ctidOf("v2"); after != before {
+		t.Errorf("unchanged tag row rewritten, ctid %v to %v", before, after)
+	}
+
+	ruleEngine, err := store.GetRuleEngine(ctx, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ruleEngine.Tags["v1"].IsEnable || ruleEngine.Tags["v2"].IsEnable || len(ruleEngine.Aliases) != 0 {
+		t.Errorf("unexpected RuleEngine %+v", ruleEngine)
+	}
+}
@@ -0,0 +1,256 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/config"
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrChangeStreamNotSupported = errors.New("change stream is not supported")
+var ErrResumeTokenExpired = errors.New("resume token is no longer available")
+var ErrChangeStreamInvalidated = errors.New("change stream invalidated")
+
+// Store is persistence layer for RuleEngine and RuleEngineConfig.
+// Every operation is atomic, failures are reported as entities.Error.
+type Store interface {
+	// creates RuleEngine with tag, or adds tag to existing RuleEngine
+	CreateRuleEngine(ctx context.Context, ruleEngineName string, tag string, config *ruleenginecore.RuleEngineConfig) *entities.Error
+
+	// clones config of tag(name, alias or digest reference) as new disabled tag of target RuleEngine,
+	// target RuleEngine is created if not exist
+	CloneTag(ctx context.Context, ruleEngineName string, tag string, targetRuleEngineName string, targetTag string) *entities.Error
+
+	// renames RuleEngine keeping tags, configs, default tag and enable state as is.
+	// shadow disagreements and audit events are carried over to new name
+	RenameRuleEngine(ctx context.Context, ruleEngineName string, newRuleEngineName string) *entities.Error
+
+	// renames tag along with every reference to it, i.e. default, aliases, traffic split, shadow and default tag history
+	RenameTag(ctx context.Context, ruleEngineName string, tag string, newTag string) *entities.Error
+
+	// imports RuleEngines of specs all or nothing, existing RuleEngine is handled as per policy i.e. skip, overwrite or fail.
+	// overwritten RuleEngine is replaced by spec, while its default tag history and audit events are kept
+	ImportRuleEngines(ctx context.Context, specs []*entities.RuleEngineSpec, policy string) (*entities.ImportResult, *entities.Error)
+
+	// computes plan of changes making RuleEngine(created if not exist) as desired, and executes it unless dryRun.
+	// routing kept as per options is taken as stored. plan is executed through tag invariants all or nothing,
+	// returns plan in execution order
+	ApplyRuleEngine(ctx context.Context, desired *entities.RuleEngineSpec, opts *entities.ApplyOptions) ([]*entities.PlanStep, *entities.Error)
+
+	// deletes RuleEngine along with every tag
+	DeleteRuleEngine(ctx context.Context, ruleEngineName string) *entities.Error
+
+	// deletes tag which is neither enabled nor default
+	DeleteRuleEngineConfig(ctx context.Context, ruleEngineName string, tag string) *entities.Error
+
+	// replaces RuleEngineConfig of tag which is neither enabled nor default
+	UpdateTagConfig(ctx context.Context, ruleEngineName string, tag string, config *ruleenginecore.RuleEngineConfig) *entities.Error
+
+	// fetches RuleEngine along with every tag and config
+	GetCompleteRuleEngine(ctx context.Context, ruleEngineName string) (*entities.CompleteRuleEngine, *entities.Error)
+
+	// sets enabled tag as default
+	SetDefaultTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error
+
+	RemoveDefaultTag(ctx context.Context, ruleEngineName string) *entities.Error
+
+	// restores most recently replaced default tag, re-enabling it if needed. returns restored tag
+	RollbackDefaultTag(ctx context.Context, ruleEngineName string) (string, *entities.Error)
+
+	EnableTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error
+
+	// disables tag which is not default
+	DisableTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error
+
+	// fetches RuleEngine without configs, nil in case RuleEngine not found
+	GetRuleEngine(ctx context.Context, ruleEngineName string) (*entities.RuleEngine, *entities.Error)
+
+	// fetches every RuleEngine without configs
+	GetAllRuleEngines(ctx context.Context) ([]*entities.RuleEngine, *entities.Error)
+
+	// fetches RuleEngines, without configs, having lastUpdateTime greater than or equal to since
+	GetRuleEnginesUpdatedSince(ctx context.Context, since int64) ([]*entities.RuleEngine, *entities.Error)
+
+	// fetches RuleEngines, without configs, matching query
+	ListRuleEngines(ctx context.Context, query *entities.ListRuleEnginesQuery) ([]*entities.RuleEngine, *entities.Error)
+
+	// fetches names of every RuleEngine
+	GetRuleEngineNames(ctx context.Context) ([]string, *entities.Error)
+
+	// sets alias to enabled tag, existing alias is re-pointed
+	SetAlias(ctx context.Context, ruleEngineName string, alias string, tag string) *entities.Error
+
+	DeleteAlias(ctx context.Context, ruleEngineName string, alias string) *entities.Error
+
+	// sets weighted traffic split over enabled tags, empty split removes it
+	SetTrafficSplit(ctx context.Context, ruleEngineName string, split []*entities.TagWeight) *entities.Error
+
+	// schedules activation and expiry of tag as unix time, 0 as not scheduled
+	SetTagSchedule(ctx context.Context, ruleEngineName string, tag string, activateAt int64, expireAt int64) *entities.Error
+
+	// fetches RuleEngines, without configs, having activation or expiry due by now
+	GetRuleEnginesScheduledBy(ctx context.Context, now int64) ([]*entities.RuleEngine, *entities.Error)
+
+	// applies activations and expiries of RuleEngine due by now, reports whether RuleEngine is changed.
+	// due state is re-read within transaction, hence safe to be applied concurrently by multiple replicas
+	ApplySchedule(ctx context.Context, ruleEngineName string, now int64) (bool, *entities.Error)
+
+	// sets enabled tag as shadow tag, empty tag removes it
+	SetShadowTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error
+
+	SaveShadowDisagreement(ctx context.Context, disagreement *entities.ShadowDisagreement) *entities.Error
+
+	// fetches disagreements of RuleEngine newest first, older than before unless before is zero
+	ListShadowDisagreements(ctx context.Context, ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.ShadowDisagreement, *entities.Error)
+
+	// fetches audit events of RuleEngine newest first, older than before unless before is zero.
+	// audit events are retained even after RuleEngine is deleted
+	ListAuditEvents(ctx context.Context, ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.AuditEvent, *entities.Error)
+
+	// fetches tag and respective RuleEngineConfig, tag is either tag name, alias or @sha256:<hex> digest reference.
+	// in case of empty tag defaultTag is considered
+	GetTagConfig(ctx context.Context, ruleEngineName string, tag string) (*entities.Tag, *ruleenginecore.RuleEngineConfig, *entities.Error)
+
+	// fetches RuleEngineConfig by id
+	GetRuleEngineConfig(ctx context.Context, engineConfigID primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, *entities.Error)
+
+	Close(ctx context.Context) error
+}
+
+// RuleEngineChange is a change observed on RuleEngine
+type RuleEngineChange struct {
+	// nil in case RuleEngine is deleted
+	RuleEngine *entities.RuleEngine
+
+	// resume token to resume watching after this change
+	ResumeToken []byte
+}
+
+type ChangeStream interface {
+	// blocks till next change is available, returns error in case of context cancellation or stream failure
+	Next(ctx context.Context) (*RuleEngineChange, error)
+
+	Close(ctx context.Context) error
+}
+
+// ChangeStreamer is implemented by Store capable of streaming RuleEngine changes
+type ChangeStreamer interface {
+	// opens change stream, resumes after resumeToken if provided.
+	// returns ErrChangeStreamNotSupported when not supported by deployment, ErrResumeTokenExpired when resumeToken is not available anymore.
+	WatchRuleEngines(ctx context.Context, resumeToken []byte) (ChangeStream, error)
+
+	// fetches persisted resume token of a worker, nil if not found
+	GetResumeToken(ctx context.Context, workerID string) ([]byte, *entities.Error)
+
+	// persists resume token of a worker
+	SaveResumeToken(ctx context.Context, workerID string, resumeToken []byte) *entities.Error
+}
+
+// resolveTag resolves tag name, alias or digest reference to tag of RuleEngine, in case of empty tag defaultTag is considered.
+// For digest reference shared by multiple tags, enabled tag is preferred and then smallest tag name.
+func resolveTag(ruleEngine *entities.RuleEngine, tag string) (*entities.Tag, *entities.Error) {
+	if tag == "" {
+		if ruleEngine.DefaultTag == "" {
+			return nil, entities.NewError(entities.ErrCodeDefaultTagNotSet)
+		}
+		tag = ruleEngine.DefaultTag
+	}
+
+	if !digest.IsReference(tag) {
+		if aliased, ok := ruleEngine.Aliases[tag]; ok {
+			tag = aliased
+		}
+		if t, ok := ruleEngine.Tags[tag]; ok {
+			return t, nil
+		}
+		return nil, entities.NewError(entities.ErrCodeTagNotFound)
+	}
+
+	var resolved *entities.Tag
+	d := digest.FromReference(tag)
+	for _, t := range ruleEngine.Tags {
+		if t.Digest != d {
+			continue
+		}
+		if resolved == nil || t.IsEnable && !resolved.IsEnable || t.IsEnable == resolved.IsEnable && t.Name < resolved.Name {
+			resolved = t
+		}
+	}
+	if resolved == nil {
+		return nil, entities.NewError(entities.ErrCodeTagNotFound)
+	}
+	return resolved, nil
+}
+
+// isReferenced reports whether tag is aliased, shadow or part of traffic split
+func isReferenced(ruleEngine *entities.RuleEngine, tag string) bool {
+	if ruleEngine.ShadowTag == tag {
+		return true
+	}
+	for _, aliased := range ruleEngine.Aliases {
+		if aliased == tag {
+			return true
+		}
+	}
+	for _, tw := range ruleEngine.TrafficSplit {
+		if tw.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTrafficSplit checks tags are distinct and enabled, weights are positive and sum up to 100
+func validateTrafficSplit(ruleEngine *entities.RuleEngine, split []*entities.TagWeight) *entities.Error {
+	total := uint(0)
+	seen := map[string]bool{}
+	for _, tw := range split {
+		if tw.Weight == 0 {
+			return entities.NewErrorWithMsg(entities.ErrCodeInvalidTrafficSplit, "weight of tag "+tw.Tag+" must be positive")
+		}
+		if seen[tw.Tag] {
+			return entities.NewErrorWithMsg(entities.ErrCodeInvalidTrafficSplit, "tag "+tw.Tag+" is repeated")
+		}
+		if t, ok := ruleEngine.Tags[tw.Tag]; !ok || !t.IsEnable {
+			return entities.NewErrorWithMsg(entities.ErrCodeInvalidTrafficSplit, "tag "+tw.Tag+" either not found or not enabled")
+		}
+		seen[tw.Tag] = true
+		total += tw.Weight
+	}
+	if total != 100 {
+		return entities.NewErrorWithMsg(entities.ErrCodeInvalidTrafficSplit, "weights must sum up to 100")
+	}
+	return nil
+}
+
+// New creates Store based on datastore configuration, exactly one datastore must be configured.
+func New() (Store, error) {
+	if config.Datastore == nil {
+		return nil, errors.New("datastore configuration not found")
+	}
+
+	configured := 0
+	for _, isConfigured := range []bool{config.Datastore.Mongo != nil, config.Datastore.Memory != nil, config.Datastore.Bolt != nil, config.Datastore.Postgres != nil} {
+		if isConfigured {
+			configured++
+		}
+	}
+	if configured != 1 {
+		return nil, errors.New("exactly one datastore must be configured")
+	}
+
+	switch {
+	case config.Datastore.Memory != nil:
+		return newMemoryStore(), nil
+	case config.Datastore.Bolt != nil:
+		return newBoltStore(config.Datastore.Bolt)
+	case config.Datastore.Postgres != nil:
+		return newPostgresStore(config.Datastore.Postgres)
+	default:
+		return newMongoStore(config.Datastore.Mongo)
+	}
+}
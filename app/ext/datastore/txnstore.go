@@ -0,0 +1,1111 @@
+package datastore
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	ruleenginecore "github.com/niharrathod/ruleengine-core"
+	"github.com/niharrathod/ruleengine/app/digest"
+	"github.com/niharrathod/ruleengine/app/entities"
+	"github.com/niharrathod/ruleengine/app/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+var errReadOnlyTxn = errors.New("write in read-only transaction")
+
+// tx is a transaction over RuleEngine and RuleEngineConfig records
+type tx interface {
+	// nil in case RuleEngine not found
+	getRuleEngine(ruleEngineName string) (*entities.RuleEngine, error)
+
+	// ordered by name
+	listRuleEngines() ([]*entities.RuleEngine, error)
+
+	putRuleEngine(ruleEngine *entities.RuleEngine) error
+
+	deleteRuleEngine(ruleEngineName string) error
+
+	// nil in case RuleEngineConfig not found
+	getConfig(id primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, error)
+
+	putConfig(engineConfig *entities.EngineConfig) error
+
+	deleteConfig(id primitive.ObjectID) error
+
+	putShadowDisagreement(disagreement *entities.ShadowDisagreement) error
+
+	// newest first, older than before unless before is zero
+	listShadowDisagreements(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.ShadowDisagreement, error)
+
+	deleteShadowDisagreements(ruleEngineName string) error
+
+	putAuditEvent(event *entities.AuditEvent) error
+
+	// newest first, older than before unless before is zero
+	listAuditEvents(ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.AuditEvent, error)
+
+	// moves disagreements and audit events of RuleEngine to new name
+	renameShadowDisagreements(ruleEngineName string, newRuleEngineName string) error
+	renameAuditEvents(ruleEngineName string, newRuleEngineName string) error
+}
+
+// txnBackend provides transactions for txnStore
+type txnBackend interface {
+	// runs fn in read-only transaction
+	view(ctx context.Context, fn func(tx) error) error
+
+	// runs fn in read-write transaction, changes are discarded in case fn returns error
+	update(ctx context.Context, fn func(tx) error) error
+
+	close(ctx context.Context) error
+}
+
+var _ Store = (*txnStore)(nil)
+
+// txnStore implements Store over a transactional backend, i.e. invariants are enforced here and backend only persists records.
+type txnStore struct {
+	backend txnBackend
+}
+
+func (s *txnStore) CreateRuleEngine(ctx context.Context, ruleEngineName string, tag string, config *ruleenginecore.RuleEngineConfig) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		ruleEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		before := auditStateOf(ruleEngine, tag)
+		if err := checkNewTag(ruleEngine, tag); err != nil {
+			return err
+		}
+
+		configDigest, err := digest.Of(config)
+		if err != nil {
+			return err
+		}
+
+		engineConfig := entities.EngineConfig{
+			ID:               primitive.NewObjectID(),
+			EngineCoreConfig: config,
+		}
+		if err := t.putConfig(&engineConfig); err != nil {
+			return err
+		}
+
+		ruleEngine = addTag(ruleEngine, ruleEngineName, tag, engineConfig.ID, configDigest)
+
+		if err := t.putRuleEngine(ruleEngine); err != nil {
+			return err
+		}
+
+		return t.putAuditEvent(newAuditEvent(ctx, entities.AuditOpCreateTag, ruleEngineName, tag, before, auditStateOf(ruleEngine, tag)))
+	})
+
+	return txnError("CreateRuleEngine", err)
+}
+
+func (s *txnStore) CloneTag(ctx context.Context, ruleEngineName string, tag string, targetRuleEngineName string, targetTag string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		sourceEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if sourceEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+
+		sourceTag, tagErr := resolveTag(sourceEngine, tag)
+		if tagErr != nil {
+			return tagErr
+		}
+
+		config, err := t.getConfig(sourceTag.EngineConfigID)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			return errors.New("RuleEngineConfig not found, EngineConfigID:" + sourceTag.EngineConfigID.Hex())
+		}
+
+		targetEngine := sourceEngine
+		if targetRuleEngineName != ruleEngineName {
+			if targetEngine, err = t.getRuleEngine(targetRuleEngineName); err != nil {
+				return err
+			}
+		}
+
+		before := auditStateOf(targetEngine, targetTag)
+		if err := checkNewTag(targetEngine, targetTag); err != nil {
+			return err
+		}
+
+		configDigest, err := digest.Of(config)
+		if err != nil {
+			return err
+		}
+
+		// fresh record, so that source and clone are independent of each other
+		engineConfig := entities.EngineConfig{
+			ID:               primitive.NewObjectID(),
+			EngineCoreConfig: config,
+		}
+		if err := t.putConfig(&engineConfig); err != nil {
+			return err
+		}
+
+		targetEngine = addTag(targetEngine, targetRuleEngineName, targetTag, engineConfig.ID, configDigest)
+		if err := t.putRuleEngine(targetEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpCloneTag, targetRuleEngineName, targetTag, before, auditStateOf(targetEngine, targetTag))
+		event.Detail = cloneDetail(ruleEngineName, sourceTag.Name)
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("CloneTag", err)
+}
+
+func (s *txnStore) RenameRuleEngine(ctx context.Context, ruleEngineName string, newRuleEngineName string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, "")
+
+		targetEngine, err := t.getRuleEngine(newRuleEngineName)
+		if err != nil {
+			return err
+		}
+		if targetEngine != nil {
+			return entities.NewError(entities.ErrCodeRuleEngineAlreadyExist)
+		}
+
+		// new incarnation, so that replicas still holding a former RuleEngine of new name take renamed one as newer
+		existingEngine.Name = newRuleEngineName
+		existingEngine.Incarnation = primitive.NewObjectID()
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+		if err := t.deleteRuleEngine(ruleEngineName); err != nil {
+			return err
+		}
+		if err := t.renameShadowDisagreements(ruleEngineName, newRuleEngineName); err != nil {
+			return err
+		}
+		if err := t.renameAuditEvents(ruleEngineName, newRuleEngineName); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpRenameRuleEngine, newRuleEngineName, "", before, auditStateOf(existingEngine, ""))
+		event.Detail = ruleEngineName
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("RenameRuleEngine", err)
+}
+
+func (s *txnStore) RenameTag(ctx context.Context, ruleEngineName string, tag string, newTag string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		if err := renameTag(existingEngine, tag, newTag); err != nil {
+			return err
+		}
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpRenameTag, ruleEngineName, newTag, before, auditStateOf(existingEngine, newTag))
+		event.Detail = tag
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("RenameTag", err)
+}
+
+func (s *txnStore) ImportRuleEngines(ctx context.Context, specs []*entities.RuleEngineSpec, policy string) (*entities.ImportResult, *entities.Error) {
+	var result *entities.ImportResult
+
+	err := s.backend.update(ctx, func(t tx) error {
+		result = &entities.ImportResult{Created: []string{}, Overwritten: []string{}, Skipped: []string{}}
+		for _, spec := range specs {
+			existingEngine, err := t.getRuleEngine(spec.Name)
+			if err != nil {
+				return err
+			}
+
+			if existingEngine != nil {
+				if policy == entities.ImportPolicySkip {
+					result.Skipped = append(result.Skipped, spec.Name)
+					continue
+				}
+				if policy != entities.ImportPolicyOverwrite {
+					return entities.NewErrorWithMsg(entities.ErrCodeRuleEngineAlreadyExist, "ruleEngine:"+spec.Name)
+				}
+			}
+
+			engineConfigIDs := map[string]primitive.ObjectID{}
+			for tag := range spec.Tags {
+				engineConfigIDs[tag] = primitive.NewObjectID()
+			}
+
+			ruleEngine, specErr := ruleEngineOf(spec, existingEngine, engineConfigIDs)
+			if specErr != nil {
+				return specError(spec.Name, specErr)
+			}
+
+			if existingEngine != nil {
+				for _, tag := range existingEngine.Tags {
+					if err := t.deleteConfig(tag.EngineConfigID); err != nil {
+						return err
+					}
+				}
+			}
+			for tag, tagSpec := range spec.Tags {
+				if err := t.putConfig(&entities.EngineConfig{ID: engineConfigIDs[tag], EngineCoreConfig: tagSpec.Config}); err != nil {
+					return err
+				}
+			}
+
+			if err := t.putRuleEngine(ruleEngine); err != nil {
+				return err
+			}
+
+			event := newAuditEvent(ctx, entities.AuditOpImportRuleEngine, spec.Name, "", auditStateOf(existingEngine, ""), auditStateOf(ruleEngine, ""))
+			if err := t.putAuditEvent(event); err != nil {
+				return err
+			}
+
+			if existingEngine != nil {
+				result.Overwritten = append(result.Overwritten, spec.Name)
+			} else {
+				result.Created = append(result.Created, spec.Name)
+			}
+		}
+		return nil
+	})
+
+	if err := txnError("ImportRuleEngines", err); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *txnStore) ApplyRuleEngine(ctx context.Context, desired *entities.RuleEngineSpec, opts *entities.ApplyOptions) ([]*entities.PlanStep, *entities.Error) {
+	var steps []*entities.PlanStep
+
+	run := s.backend.update
+	if opts.DryRun {
+		run = s.backend.view
+	}
+	err := run(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(desired.Name)
+		if err != nil {
+			return err
+		}
+
+		// tags stored before digests would otherwise always differ from desired config
+		if existingEngine != nil {
+			if _, err := fillDigests(existingEngine, t.getConfig); err != nil {
+				return err
+			}
+		}
+		desired := withKeptRouting(existingEngine, desired, opts)
+
+		var planErr *entities.Error
+		if steps, planErr = planOf(existingEngine, desired); planErr != nil {
+			return planErr
+		}
+		if len(steps) == 0 {
+			return nil
+		}
+
+		// executed even for dryRun, so that plan violating invariants is reported
+		ruleEngine, writes, events, planErr := executePlan(ctx, existingEngine, desired, steps)
+		if planErr != nil {
+			return planErr
+		}
+		if opts.DryRun {
+			return nil
+		}
+
+		for _, engineConfig := range writes.configs {
+			if err := t.putConfig(engineConfig); err != nil {
+				return err
+			}
+		}
+		for _, id := range writes.deletedConfigIDs {
+			if err := t.deleteConfig(id); err != nil {
+				return err
+			}
+		}
+
+		if err := t.putRuleEngine(ruleEngine); err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if err := t.putAuditEvent(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err := txnError("ApplyRuleEngine", err); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+func (s *txnStore) DeleteRuleEngine(ctx context.Context, ruleEngineName string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+
+		for _, tag := range existingEngine.Tags {
+			if err := t.deleteConfig(tag.EngineConfigID); err != nil {
+				return err
+			}
+		}
+
+		if err := t.deleteShadowDisagreements(ruleEngineName); err != nil {
+			return err
+		}
+
+		if err := t.deleteRuleEngine(ruleEngineName); err != nil {
+			return err
+		}
+
+		return t.putAuditEvent(newAuditEvent(ctx, entities.AuditOpDeleteRuleEngine, ruleEngineName, "", auditStateOf(existingEngine, ""), nil))
+	})
+
+	return txnError("DeleteRuleEngine", err)
+}
+
+func (s *txnStore) DeleteRuleEngineConfig(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		tg, dsErr := deleteTag(existingEngine, tag)
+		if dsErr != nil {
+			return dsErr
+		}
+
+		if err := t.deleteConfig(tg.EngineConfigID); err != nil {
+			return err
+		}
+
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpDeleteTag, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("DeleteRuleEngineConfig", err)
+}
+
+func (s *txnStore) UpdateTagConfig(ctx context.Context, ruleEngineName string, tag string, config *ruleenginecore.RuleEngineConfig) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		tg, ok := existingEngine.Tags[tag]
+		if !ok {
+			return entities.NewError(entities.ErrCodeTagNotFound)
+		}
+		if tg.IsEnable || existingEngine.DefaultTag == tag {
+			return entities.NewError(entities.ErrCodeTagUpdateNotAllowed)
+		}
+
+		configDigest, err := digest.Of(config)
+		if err != nil {
+			return err
+		}
+
+		// new id, so that cached RuleEngine instances of old config are never reused
+		engineConfig := entities.EngineConfig{
+			ID:               primitive.NewObjectID(),
+			EngineCoreConfig: config,
+		}
+		if err := t.putConfig(&engineConfig); err != nil {
+			return err
+		}
+		if err := t.deleteConfig(tg.EngineConfigID); err != nil {
+			return err
+		}
+
+		tg.EngineConfigID = engineConfig.ID
+		tg.Digest = configDigest
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpUpdateTagConfig, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("UpdateTagConfig", err)
+}
+
+func (s *txnStore) GetCompleteRuleEngine(ctx context.Context, ruleEngineName string) (*entities.CompleteRuleEngine, *entities.Error) {
+	var result *entities.CompleteRuleEngine
+
+	err := s.backend.view(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+
+		result = &entities.CompleteRuleEngine{
+			Name:       existingEngine.Name,
+			DefaultTag: existingEngine.DefaultTag,
+			Tags:       map[string]*entities.TagResponse{},
+			Aliases:    map[string]string{},
+		}
+		for alias, tag := range existingEngine.Aliases {
+			result.Aliases[alias] = tag
+		}
+		result.TrafficSplit = existingEngine.TrafficSplit
+		result.ShadowTag = existingEngine.ShadowTag
+		result.DefaultTagHistory = existingEngine.DefaultTagHistory
+
+		for tag, tg := range existingEngine.Tags {
+			config, err := t.getConfig(tg.EngineConfigID)
+			if err != nil {
+				return err
+			}
+			result.Tags[tag] = entities.NewTagResponse(tg, config)
+		}
+		return nil
+	})
+
+	if err := txnError("GetCompleteRuleEngine", err); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *txnStore) SetDefaultTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		if err := setDefaultTag(existingEngine, tag); err != nil {
+			return err
+		}
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpSetDefaultTag, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("SetDefaultTag", err)
+}
+
+func (s *txnStore) RemoveDefaultTag(ctx context.Context, ruleEngineName string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, "")
+
+		existingEngine.LastUpdateTime = time.Now().Unix()
+		removeDefaultTag(existingEngine)
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpRemoveDefaultTag, ruleEngineName, "", before, auditStateOf(existingEngine, ""))
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("RemoveDefaultTag", err)
+}
+
+func (s *txnStore) RollbackDefaultTag(ctx context.Context, ruleEngineName string) (string, *entities.Error) {
+	var tag string
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, previousDefaultTag(existingEngine))
+
+		var rollbackErr *entities.Error
+		if tag, rollbackErr = rollbackDefaultTag(existingEngine); rollbackErr != nil {
+			return rollbackErr
+		}
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpRollbackDefaultTag, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		return t.putAuditEvent(event)
+	})
+
+	if err := txnError("RollbackDefaultTag", err); err != nil {
+		return "", err
+	}
+	return tag, nil
+}
+
+func (s *txnStore) EnableTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		changed, tagErr := enableTag(existingEngine, tag)
+		if tagErr != nil {
+			return tagErr
+		}
+		if !changed {
+			return nil
+		}
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpEnableTag, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("EnableTag", err)
+}
+
+func (s *txnStore) DisableTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		changed, tagErr := disableTag(existingEngine, tag)
+		if tagErr != nil {
+			return tagErr
+		}
+		if !changed {
+			return nil
+		}
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpDisableTag, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("DisableTag", err)
+}
+
+func (s *txnStore) SetAlias(ctx context.Context, ruleEngineName string, alias string, tag string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		previous := existingEngine.Aliases[alias]
+		if err := setAlias(existingEngine, alias, tag); err != nil {
+			return err
+		}
+		if previous == tag {
+			return nil
+		}
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpSetAlias, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		event.Detail = alias
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("SetAlias", err)
+}
+
+func (s *txnStore) DeleteAlias(ctx context.Context, ruleEngineName string, alias string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, "")
+
+		if _, ok := existingEngine.Aliases[alias]; !ok {
+			return entities.NewError(entities.ErrCodeAliasNotFound)
+		}
+
+		delete(existingEngine.Aliases, alias)
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpDeleteAlias, ruleEngineName, "", before, auditStateOf(existingEngine, ""))
+		event.Detail = alias
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("DeleteAlias", err)
+}
+
+func (s *txnStore) SetTrafficSplit(ctx context.Context, ruleEngineName string, split []*entities.TagWeight) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, "")
+
+		if len(split) != 0 {
+			if err := validateTrafficSplit(existingEngine, split); err != nil {
+				return err
+			}
+		}
+
+		existingEngine.TrafficSplit = split
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpSetTrafficSplit, ruleEngineName, "", before, auditStateOf(existingEngine, ""))
+		event.Detail = trafficSplitDetail(split)
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("SetTrafficSplit", err)
+}
+
+func (s *txnStore) SetTagSchedule(ctx context.Context, ruleEngineName string, tag string, activateAt int64, expireAt int64) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		if err := setTagSchedule(existingEngine, tag, activateAt, expireAt); err != nil {
+			return err
+		}
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpSetTagSchedule, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		event.Detail = scheduleDetail(activateAt, expireAt)
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("SetTagSchedule", err)
+}
+
+func (s *txnStore) GetRuleEnginesScheduledBy(ctx context.Context, now int64) ([]*entities.RuleEngine, *entities.Error) {
+	return s.filterRuleEngines(ctx, "GetRuleEnginesScheduledBy", func(ruleEngine *entities.RuleEngine) bool {
+		return ruleEngine.NextScheduleTime != 0 && ruleEngine.NextScheduleTime <= now
+	})
+}
+
+func (s *txnStore) ApplySchedule(ctx context.Context, ruleEngineName string, now int64) (bool, *entities.Error) {
+	changed := false
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return nil
+		}
+
+		var events []*entities.AuditEvent
+		if changed, events = applySchedule(ctx, existingEngine, now); !changed {
+			return nil
+		}
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if err := t.putAuditEvent(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err := txnError("ApplySchedule", err); err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+func (s *txnStore) SetShadowTag(ctx context.Context, ruleEngineName string, tag string) *entities.Error {
+
+	err := s.backend.update(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+		before := auditStateOf(existingEngine, tag)
+
+		previous := existingEngine.ShadowTag
+		if err := setShadowTag(existingEngine, tag); err != nil {
+			return err
+		}
+		if previous == tag {
+			return nil
+		}
+		existingEngine.LastUpdateTime = time.Now().Unix()
+
+		if err := t.putRuleEngine(existingEngine); err != nil {
+			return err
+		}
+
+		event := newAuditEvent(ctx, entities.AuditOpSetShadowTag, ruleEngineName, tag, before, auditStateOf(existingEngine, tag))
+		return t.putAuditEvent(event)
+	})
+
+	return txnError("SetShadowTag", err)
+}
+
+func (s *txnStore) SaveShadowDisagreement(ctx context.Context, disagreement *entities.ShadowDisagreement) *entities.Error {
+	err := s.backend.update(ctx, func(t tx) error {
+		return t.putShadowDisagreement(disagreement)
+	})
+	return txnError("SaveShadowDisagreement", err)
+}
+
+func (s *txnStore) ListShadowDisagreements(ctx context.Context, ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.ShadowDisagreement, *entities.Error) {
+	var disagreements []*entities.ShadowDisagreement
+
+	err := s.backend.view(ctx, func(t tx) error {
+		var err error
+		disagreements, err = t.listShadowDisagreements(ruleEngineName, before, limit)
+		return err
+	})
+
+	if err := txnError("ListShadowDisagreements", err); err != nil {
+		return nil, err
+	}
+	return disagreements, nil
+}
+
+func (s *txnStore) ListAuditEvents(ctx context.Context, ruleEngineName string, before primitive.ObjectID, limit int) ([]*entities.AuditEvent, *entities.Error) {
+	var events []*entities.AuditEvent
+
+	err := s.backend.view(ctx, func(t tx) error {
+		var err error
+		events, err = t.listAuditEvents(ruleEngineName, before, limit)
+		return err
+	})
+
+	if err := txnError("ListAuditEvents", err); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (s *txnStore) GetRuleEngine(ctx context.Context, ruleEngineName string) (*entities.RuleEngine, *entities.Error) {
+	var ruleEngine *entities.RuleEngine
+
+	err := s.backend.view(ctx, func(t tx) error {
+		var err error
+		ruleEngine, err = t.getRuleEngine(ruleEngineName)
+		return err
+	})
+
+	if err := txnError("GetRuleEngine", err); err != nil {
+		return nil, err
+	}
+	return ruleEngine, nil
+}
+
+func (s *txnStore) GetAllRuleEngines(ctx context.Context) ([]*entities.RuleEngine, *entities.Error) {
+	return s.filterRuleEngines(ctx, "GetAllRuleEngines", func(*entities.RuleEngine) bool { return true })
+}
+
+func (s *txnStore) GetRuleEnginesUpdatedSince(ctx context.Context, since int64) ([]*entities.RuleEngine, *entities.Error) {
+	return s.filterRuleEngines(ctx, "GetRuleEnginesUpdatedSince", func(ruleEngine *entities.RuleEngine) bool {
+		return ruleEngine.LastUpdateTime >= since
+	})
+}
+
+func (s *txnStore) ListRuleEngines(ctx context.Context, query *entities.ListRuleEnginesQuery) ([]*entities.RuleEngine, *entities.Error) {
+	// before reports whether (name, lastUpdateTime) a is positioned before b in requested sort order
+	before := func(aName string, aTime int64, bName string, bTime int64) bool {
+		if query.SortBy == entities.SortByLastUpdateTime && aTime != bTime {
+			return (aTime < bTime) != query.Descending
+		}
+		return aName != bName && (aName < bName) != query.Descending
+	}
+
+	ruleEngines, err := s.filterRuleEngines(ctx, "ListRuleEngines", func(ruleEngine *entities.RuleEngine) bool {
+		if !strings.HasPrefix(ruleEngine.Name, query.NamePrefix) {
+			return false
+		}
+		return !query.HasCursor || before(query.AfterName, query.AfterLastUpdateTime, ruleEngine.Name, ruleEngine.LastUpdateTime)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ruleEngines, func(i, j int) bool {
+		return before(ruleEngines[i].Name, ruleEngines[i].LastUpdateTime, ruleEngines[j].Name, ruleEngines[j].LastUpdateTime)
+	})
+
+	if len(ruleEngines) > query.Limit {
+		ruleEngines = ruleEngines[:query.Limit]
+	}
+	return ruleEngines, nil
+}
+
+func (s *txnStore) GetRuleEngineNames(ctx context.Context) ([]string, *entities.Error) {
+	ruleEngines, err := s.filterRuleEngines(ctx, "GetRuleEngineNames", func(*entities.RuleEngine) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(ruleEngines))
+	for _, ruleEngine := range ruleEngines {
+		names = append(names, ruleEngine.Name)
+	}
+	return names, nil
+}
+
+func (s *txnStore) GetTagConfig(ctx context.Context, ruleEngineName string, tag string) (*entities.Tag, *ruleenginecore.RuleEngineConfig, *entities.Error) {
+	var resultTag *entities.Tag
+	var resultConfig *ruleenginecore.RuleEngineConfig
+
+	err := s.backend.view(ctx, func(t tx) error {
+		existingEngine, err := t.getRuleEngine(ruleEngineName)
+		if err != nil {
+			return err
+		}
+
+		if existingEngine == nil {
+			return entities.NewError(entities.ErrCodeRuleEngineNotFound)
+		}
+
+		tg, tagErr := resolveTag(existingEngine, tag)
+		if tagErr != nil {
+			return tagErr
+		}
+
+		config, err := t.getConfig(tg.EngineConfigID)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			return errors.New("RuleEngineConfig not found, EngineConfigID:" + tg.EngineConfigID.Hex())
+		}
+
+		resultTag, resultConfig = tg, config
+		return nil
+	})
+
+	if err := txnError("GetTagConfig", err); err != nil {
+		return nil, nil, err
+	}
+	return resultTag, resultConfig, nil
+}
+
+func (s *txnStore) GetRuleEngineConfig(ctx context.Context, engineConfigID primitive.ObjectID) (*ruleenginecore.RuleEngineConfig, *entities.Error) {
+	var config *ruleenginecore.RuleEngineConfig
+
+	err := s.backend.view(ctx, func(t tx) error {
+		var err error
+		if config, err = t.getConfig(engineConfigID); err != nil {
+			return err
+		}
+		if config == nil {
+			return errors.New("RuleEngineConfig not found, EngineConfigID:" + engineConfigID.Hex())
+		}
+		return nil
+	})
+
+	if err := txnError("GetRuleEngineConfig", err); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (s *txnStore) Close(ctx context.Context) error {
+	return s.backend.close(ctx)
+}
+
+func (s *txnStore) filterRuleEngines(ctx context.Context, operation string, include func(*entities.RuleEngine) bool) ([]*entities.RuleEngine, *entities.Error) {
+	result := []*entities.RuleEngine{}
+
+	err := s.backend.view(ctx, func(t tx) error {
+		ruleEngines, err := t.listRuleEngines()
+		if err != nil {
+			return err
+		}
+		for _, ruleEngine := range ruleEngines {
+			if include(ruleEngine) {
+				result = append(result, ruleEngine)
+			}
+		}
+		return nil
+	})
+
+	if err := txnError(operation, err); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// txnError maps transaction failure, entities.Error is returned as is otherwise considered as datastore failure.
+func txnError(operation string, err error) *entities.Error {
+	if err == nil {
+		return nil
+	}
+
+	if txnErr, ok := err.(*entities.Error); ok {
+		log.Logger.Error(operation+" transaction failed", zap.String("Error", txnErr.Error()))
+		return txnErr
+	}
+
+	log.Logger.Error(operation+" transaction failed, assert txnError failed", zap.String("Error", err.Error()))
+	return entities.NewError(entities.ErrCodeDatastoreFailed)
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/niharrathod/ruleengine/app/audit"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ActorHeader     = "X-Actor"
+	RequestIDHeader = "X-Request-ID"
+)
+
+// Origin attaches caller(X-Actor header) and request ID(X-Request-ID header, generated if absent) to request context
+// for audit, request ID is echoed in response header.
+// X-Actor is not authenticated, i.e. audited actor is advisory as any caller could claim any actor. Deployments needing
+// trustworthy actor should set the header at an authenticating proxy and drop the caller supplied one.
+func Origin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		origin := &audit.Origin{
+			Actor:     ctx.GetHeader(ActorHeader),
+			RequestID: ctx.GetHeader(RequestIDHeader),
+		}
+		if origin.Actor == "" {
+			origin.Actor = audit.UnknownActor
+		}
+		if origin.RequestID == "" {
+			origin.RequestID = primitive.NewObjectID().Hex()
+		}
+
+		ctx.Request = ctx.Request.WithContext(audit.NewContext(ctx.Request.Context(), origin))
+		ctx.Header(RequestIDHeader, origin.RequestID)
+		ctx.Next()
+	}
+}